@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-kit/log"
@@ -14,19 +20,24 @@ import (
 	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/common/promlog/flag"
 	"github.com/prometheus/common/version"
+	"github.com/prometheus/exporter-toolkit/web"
+	webflag "github.com/prometheus/exporter-toolkit/web/kingpinflag"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
 
 	"tencentcloud-exporter/pkg/cachedtransactiongather"
+	"tencentcloud-exporter/pkg/client"
 	"tencentcloud-exporter/pkg/collector"
 	"tencentcloud-exporter/pkg/common"
 	"tencentcloud-exporter/pkg/config"
 )
 
 func newHandler(
-	cred common.CredentialIface,
+	nc *collector.TcMonitorCollector,
 	c *config.TencentConfig,
 	includeExporterMetrics bool,
 	maxRequests int,
+	timeoutOffset time.Duration,
 	logger log.Logger,
 ) (*http.Handler, error) {
 
@@ -38,32 +49,41 @@ func newHandler(
 		)
 	}
 
-	nc, err := collector.NewTcMonitorCollector(cred, c, logger)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't create collector: %s", err)
-	}
-	r := prometheus.NewRegistry()
-	r.MustRegister(version.NewCollector("qcloud_exporter"))
-	if err := r.Register(nc); err != nil {
-		return nil, fmt.Errorf("couldn't register tencent cloud monitor collector: %s", err)
-	}
+	versionCollector := version.NewCollector("qcloud_exporter")
 	var handler http.Handler
-	gatherers := prometheus.Gatherers{exporterMetricsRegistry, r}
 	opts := promhttp.HandlerOpts{
-		ErrorHandling:       promhttp.ContinueOnError,
-		MaxRequestsInFlight: maxRequests,
-		Registry:            exporterMetricsRegistry,
+		ErrorHandling: promhttp.ContinueOnError,
+		Registry:      exporterMetricsRegistry,
 	}
 	if c.CacheInterval <= 0 {
-		handler = promhttp.HandlerFor(gatherers, opts)
+		// 每次抓取使用单独的registry, 将请求的超时传给采集器
+		handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx, cancel := scrapeContext(req, timeoutOffset)
+			defer cancel()
+			r := prometheus.NewRegistry()
+			r.MustRegister(versionCollector)
+			if err := r.Register(nc.WithContext(ctx)); err != nil {
+				level.Error(logger).Log("msg", "Couldn't register tencent cloud monitor collector", "err", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			promhttp.HandlerFor(prometheus.Gatherers{exporterMetricsRegistry, r}, opts).ServeHTTP(w, req)
+		})
 	} else {
+		// 缓存的结果由多个请求共用, 不绑定单个请求的超时
+		r := prometheus.NewRegistry()
+		r.MustRegister(versionCollector)
+		if err := r.Register(nc); err != nil {
+			return nil, fmt.Errorf("couldn't register tencent cloud monitor collector: %s", err)
+		}
 		handler = promhttp.HandlerForTransactional(
 			cachedtransactiongather.NewCachedTransactionGather(
-				prometheus.ToTransactionalGatherer(gatherers),
+				prometheus.ToTransactionalGatherer(prometheus.Gatherers{exporterMetricsRegistry, r}),
 				time.Duration(c.CacheInterval)*time.Second, logger,
 			), opts,
 		)
 	}
+	handler = limitRequestsInFlight(handler, maxRequests)
 
 	if includeExporterMetrics {
 		handler = promhttp.InstrumentMetricHandler(
@@ -74,6 +94,88 @@ func newHandler(
 
 }
 
+// 按Prometheus传入的抓取超时生成ctx, 预留timeoutOffset用于返回响应
+func scrapeContext(req *http.Request, timeoutOffset time.Duration) (context.Context, context.CancelFunc) {
+	v := req.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if v == "" {
+		return context.WithCancel(req.Context())
+	}
+	seconds, err := strconv.ParseFloat(v, 64)
+	if err != nil || seconds <= 0 {
+		return context.WithCancel(req.Context())
+	}
+	timeout := time.Duration(seconds*float64(time.Second)) - timeoutOffset
+	if timeout <= 0 {
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	return context.WithTimeout(req.Context(), timeout)
+}
+
+// 与promhttp.HandlerOpts.MaxRequestsInFlight一致, 每次请求新建handler时在外层限制并发
+func limitRequestsInFlight(handler http.Handler, maxRequests int) http.Handler {
+	if maxRequests <= 0 {
+		return handler
+	}
+	inFlightSem := make(chan struct{}, maxRequests)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case inFlightSem <- struct{}{}:
+			defer func() { <-inFlightSem }()
+		default:
+			http.Error(w, fmt.Sprintf(
+				"Limit of concurrent requests reached (%d), try again later.", maxRequests,
+			), http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// 校验Authorization: Bearer <token>, basic auth也使用Authorization头, 不能与web.config.file中的basic_auth_users同时配置
+func requireBearerToken(handler http.Handler, token string) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// 从文件读取bearer token, 去掉首尾空白
+func readBearerToken(filename string) (string, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("bearer token file %s is empty", filename)
+	}
+	return token, nil
+}
+
+// basic auth也使用Authorization头, web.config.file中配置了basic_auth_users时不能再使用bearer token
+func checkBearerTokenWebConfig(webConfigFile string) error {
+	if webConfigFile == "" {
+		return nil
+	}
+	content, err := os.ReadFile(webConfigFile)
+	if err != nil {
+		return err
+	}
+	c := &web.Config{}
+	if err := yaml.Unmarshal(content, c); err != nil {
+		return err
+	}
+	if len(c.Users) != 0 {
+		return fmt.Errorf("--web.bearer-token-file cannot be used with basic_auth_users in %s", webConfigFile)
+	}
+	return nil
+}
+
 func main() {
 	var (
 		listenAddress = kingpin.Flag(
@@ -92,9 +194,28 @@ func main() {
 			"web.max-requests",
 			"Maximum number of parallel scrape requests. Use 0 to disable.",
 		).Default("0").Int()
+		timeoutOffset = kingpin.Flag(
+			"web.timeout-offset",
+			"Offset to subtract from the Prometheus scrape timeout, reserved for writing the response.",
+		).Default("0.5s").Duration()
+		shutdownTimeout = kingpin.Flag(
+			"web.shutdown-timeout",
+			"Maximum time to wait for in-flight scrapes to finish on shutdown.",
+		).Default("25s").Duration()
+		webConfig       = webflag.AddFlags(kingpin.CommandLine)
+		bearerTokenFile = kingpin.Flag(
+			"web.bearer-token-file",
+			"Path to a file containing the bearer token required in the Authorization header of all requests.",
+		).Default("").String()
 		configFile = kingpin.Flag(
 			"config.file", "Tencent qcloud exporter configuration file.",
 		).Default("qcloud.yml").String()
+		apiRecord = kingpin.Flag(
+			"api.record", "Record all Tencent Cloud API requests and responses to the directory, credentials are redacted.",
+		).Default("").String()
+		apiReplay = kingpin.Flag(
+			"api.replay", "Serve Tencent Cloud API responses from the directory recorded by --api.record, without network access.",
+		).Default("").String()
 	)
 
 	promlogConfig := &promlog.Config{}
@@ -107,6 +228,13 @@ func main() {
 	level.Info(logger).Log("msg", "Starting qcloud_exporter", "version", version.Info())
 	level.Info(logger).Log("msg", "Build context", "build_context", version.BuildContext())
 
+	if *bearerTokenFile != "" {
+		if err := checkBearerTokenWebConfig(*webConfig); err != nil {
+			level.Error(logger).Log("msg", "Check web config fail", "err", err)
+			os.Exit(1)
+		}
+	}
+
 	tencentConfig := config.NewConfig()
 	if err := tencentConfig.LoadFile(*configFile); err != nil {
 		level.Error(logger).Log("msg", "Load config error", "err", err)
@@ -115,6 +243,29 @@ func main() {
 		level.Info(logger).Log("msg", "Load config ok")
 	}
 
+	if *apiRecord != "" && *apiReplay != "" {
+		level.Error(logger).Log("msg", "--api.record and --api.replay cannot be used together")
+		os.Exit(1)
+	}
+	if *apiRecord != "" {
+		if err := client.EnableRecord(*apiRecord); err != nil {
+			level.Error(logger).Log("msg", "Enable api record fail", "err", err)
+			os.Exit(1)
+		}
+		level.Info(logger).Log("msg", "Recording api requests", "dir", *apiRecord)
+	}
+	if *apiReplay != "" {
+		if err := client.EnableReplay(*apiReplay); err != nil {
+			level.Error(logger).Log("msg", "Enable api replay fail", "err", err)
+			os.Exit(1)
+		}
+		level.Info(logger).Log("msg", "Replaying api requests", "dir", *apiReplay)
+	}
+
+	// 收到退出信号后取消所有后台任务
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	cred := &common.Credential{}
 	if tencentConfig.Credential.Role != "" {
 		var err error
@@ -124,7 +275,7 @@ func main() {
 			panic(err)
 		}
 		go func() {
-			err := cred.Refresh()
+			err := cred.Refresh(ctx)
 			if err != nil {
 				level.Error(logger).Log("msg", "cred refresh error", "err", err)
 				panic(err)
@@ -135,27 +286,73 @@ func main() {
 		cred.SecretKey = tencentConfig.Credential.SecretKey
 	}
 
-	handler, err := newHandler(cred, tencentConfig, *enableExporterMetrics, *maxRequests, logger)
+	nc, err := collector.NewTcMonitorCollector(ctx, cred, tencentConfig, logger)
+	if err != nil {
+		level.Error(logger).Log("msg", "Create collector fail", "err", err)
+		os.Exit(1)
+	}
+	handler, err := newHandler(nc, tencentConfig, *enableExporterMetrics, *maxRequests, *timeoutOffset, logger)
 	if err != nil {
 		level.Error(logger).Log("msg", "Create handler fail", "err", err)
 		os.Exit(1)
 	}
 
 	http.Handle(*metricsPath, *handler)
+	registerCatalogHandler(http.DefaultServeMux, nc, logger)
+	registerStatusHandlers(http.DefaultServeMux, nc, logger)
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
 			<head><title>QCloud Exporter</title></head>
 			<body>
 			<h1>QCloud Exporter</h1>
 			<p><a href="` + *metricsPath + `">Metrics</a></p>
+			<p><a href="/api/v1/catalog">Metric catalog</a></p>
+			<p><a href="/status">Status</a></p>
 			</body>
 			</html>`))
 	})
 
-	level.Info(logger).Log("msg", "Listening on", "address", *listenAddress)
-	err = http.ListenAndServe(*listenAddress, nil)
-	if err != nil {
+	var rootHandler http.Handler = http.DefaultServeMux
+	if *bearerTokenFile != "" {
+		token, err := readBearerToken(*bearerTokenFile)
+		if err != nil {
+			level.Error(logger).Log("msg", "Load bearer token fail", "err", err)
+			os.Exit(1)
+		}
+		rootHandler = requireBearerToken(rootHandler, token)
+	}
+
+	// web.config.file可以开启TLS、客户端证书校验和basic auth
+	server := &http.Server{Addr: *listenAddress, Handler: rootHandler}
+	serverErr := make(chan error, 1)
+	go func() {
+		level.Info(logger).Log("msg", "Listening on", "address", *listenAddress)
+		serverErr <- web.ListenAndServe(server, *webConfig, logger)
+	}()
+
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM, syscall.SIGINT)
+	exitCode := 0
+	select {
+	case sig := <-term:
+		level.Info(logger).Log("msg", "Received signal, shutting down", "signal", sig.String())
+	case err := <-serverErr:
 		level.Error(logger).Log("err", err)
-		os.Exit(1)
+		exitCode = 1
+	}
+
+	// 先停止接收新请求, 等待正在进行的抓取完成
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		level.Warn(logger).Log("msg", "Drain in-flight scrapes timeout, close server", "err", err)
+		server.Close()
+	}
+	shutdownCancel()
+
+	cancel()
+	if err := nc.Close(); err != nil {
+		level.Error(logger).Log("msg", "Close collector fail", "err", err)
 	}
+	level.Info(logger).Log("msg", "Shutdown complete")
+	os.Exit(exitCode)
 }
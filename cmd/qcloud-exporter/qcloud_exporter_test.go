@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_requireBearerToken(t *testing.T) {
+	handler := requireBearerToken(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("ok"))
+	}), "secret-token")
+
+	cases := []struct {
+		name          string
+		authorization string
+		wantCode      int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer wrong-token", http.StatusUnauthorized},
+		{"basic auth", "Basic dXNlcjpzZWNyZXQtdG9rZW4=", http.StatusUnauthorized},
+		{"correct token", "Bearer secret-token", http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if c.authorization != "" {
+				req.Header.Set("Authorization", c.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, c.wantCode, rec.Code)
+			if c.wantCode == http.StatusUnauthorized {
+				assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+			} else {
+				assert.Equal(t, "ok", rec.Body.String())
+			}
+		})
+	}
+}
+
+func Test_checkBearerTokenWebConfig(t *testing.T) {
+	write := func(content string) string {
+		filename := filepath.Join(t.TempDir(), "web.yml")
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	assert.NoError(t, checkBearerTokenWebConfig(""))
+	assert.NoError(t, checkBearerTokenWebConfig(write("tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n")))
+	assert.Error(t, checkBearerTokenWebConfig(write("basic_auth_users:\n  admin: $2y$10$abcdefghijklmnopqrstuv\n")))
+	assert.Error(t, checkBearerTokenWebConfig(filepath.Join(t.TempDir(), "not-exist.yml")))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	"tencentcloud-exporter/pkg/collector"
+)
+
+var statusTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"seconds": formatSeconds,
+	"anchor":  func(namespace string) string { return strings.Replace(namespace, "/", "-", -1) },
+}).Parse(`<html>
+<head>
+<title>QCloud Exporter Status</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+.error { color: #c00; }
+</style>
+</head>
+<body>
+<h1>QCloud Exporter Status</h1>
+<p><a href="/">Home</a> <a href="/api/v1/status">JSON</a></p>
+<h2>Collectors</h2>
+<table>
+<tr><th>Namespace</th><th>Metrics</th><th>Series</th><th>Instances</th><th>Last collect</th><th>Duration</th><th>Next reload</th><th>Error</th></tr>
+{{range .Collectors}}
+<tr>
+<td><a href="#{{anchor .Namespace}}">{{.Namespace}}</a></td><td>{{.NumMetrics}}</td><td>{{.NumSeries}}</td><td>{{.NumInstances}}</td>
+<td>{{if .LastCollectTime.IsZero}}-{{else}}{{.LastCollectTime.Format "2006-01-02 15:04:05"}}{{end}}</td>
+<td>{{seconds .LastCollectSeconds}}</td>
+<td>{{if .NextReloadTime}}{{.NextReloadTime.Format "2006-01-02 15:04:05"}}{{else}}-{{end}}</td>
+<td class="error">{{.LastCollectError}}</td>
+</tr>
+{{end}}
+</table>
+{{range .Collectors}}
+<h2 id="{{anchor .Namespace}}">{{.Namespace}}</h2>
+<table>
+<tr><th>Metric</th><th>Series</th><th>Status</th><th>Last query</th><th>Duration</th><th>Exported</th><th>No data</th><th>Error</th></tr>
+{{range .Metrics}}
+<tr>
+<td>{{.MetricName}}</td><td>{{.NumSeries}}</td><td>{{.Status}}</td>
+<td>{{if .LatestQueryTime.IsZero}}-{{else}}{{.LatestQueryTime.Format "2006-01-02 15:04:05"}}{{end}}</td>
+<td>{{seconds .LatestSeconds}}</td><td>{{.LatestPoints}}</td>
+<td>{{if .NodataSeries}}<details><summary>{{len .NodataSeries}}</summary>{{range .NodataSeries}}{{.}}<br>{{end}}</details>{{else}}0{{end}}</td>
+<td class="error">{{.LatestError}}</td>
+</tr>
+{{end}}
+</table>
+{{end}}
+<h2>Configuration</h2>
+<pre>{{.Config}}</pre>
+</body>
+</html>`))
+
+func formatSeconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', 3, 64) + "s"
+}
+
+// /status页面和/api/v1/status, 展示生效的配置和每个产品、指标的采集状态
+func registerStatusHandlers(mux *http.ServeMux, nc *collector.TcMonitorCollector, logger log.Logger) {
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := statusTemplate.Execute(w, nc.Status()); err != nil {
+			level.Error(logger).Log("msg", "Render status page fail", "err", err)
+		}
+	})
+	mux.HandleFunc("/api/v1/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(nc.Status()); err != nil {
+			level.Error(logger).Log("msg", "Encode status fail", "err", err)
+		}
+	})
+}
+
+// /api/v1/catalog, 以json格式返回所有正在采集的指标, 用于生成文档
+func registerCatalogHandler(mux *http.ServeMux, nc *collector.TcMonitorCollector, logger log.Logger) {
+	mux.HandleFunc("/api/v1/catalog", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(nc.Catalog()); err != nil {
+			level.Error(logger).Log("msg", "Encode metric catalog fail", "err", err)
+		}
+	})
+}
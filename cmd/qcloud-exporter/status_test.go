@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"tencentcloud-exporter/pkg/collector"
+	"tencentcloud-exporter/pkg/common"
+	"tencentcloud-exporter/pkg/config"
+	"tencentcloud-exporter/pkg/fakecloud"
+	"tencentcloud-exporter/pkg/metric"
+)
+
+func Test_CatalogHandler(t *testing.T) {
+	s := fakecloud.NewServer("AKIDcatalog", "catalog")
+	defer s.Close()
+	if err := s.LoadFixtures(filepath.Join("..", "..", "pkg", "collector", "testdata", "golden", "cvm")); err != nil {
+		t.Fatal(err)
+	}
+	s.AddMetric(fakecloud.NewMetricSet("QCE/CVM", "CpuUsage", "%", "max", []int64{60, 300}, []string{"InstanceId"}))
+
+	content := fmt.Sprintf(`credential:
+  access_key: %s
+  secret_key: %s
+  region: ap-guangzhou
+client:
+  endpoint: %s
+products:
+  - namespace: QCE/CVM
+    all_metrics: true
+    all_instances: true
+    statistics_types: [last, p99]
+`, s.SecretId, s.SecretKey, s.URL())
+	filename := filepath.Join(t.TempDir(), "qcloud.yml")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := config.NewConfig()
+	if err := conf.LoadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cred := &common.Credential{SecretId: s.SecretId, SecretKey: s.SecretKey}
+	nc, err := collector.NewTcMonitorCollector(ctx, cred, conf, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	registerCatalogHandler(mux, nc, log.NewNopLogger())
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/catalog", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var items []*metric.TcmMetricCatalogItem
+	if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, items, 1) {
+		return
+	}
+	item := items[0]
+	assert.Equal(t, "QCE/CVM", item.Namespace)
+	assert.Equal(t, "CpuUsage", item.MetricName)
+	assert.Equal(t, "%", item.Unit)
+	assert.Equal(t, "CpuUsage", item.MeaningEn)
+	assert.Equal(t, []string{"InstanceId"}, item.Dimensions)
+	assert.Equal(t, []int64{60, 300}, item.Periods)
+	assert.Equal(t, int64(60), item.Period)
+	assert.Contains(t, item.Labels, "InstanceId")
+	// 每个统计方法一个导出的指标, 按指标名排序
+	if assert.Len(t, item.Metrics, 2) {
+		assert.Equal(t, "qce_cvm_cpuusage_max", item.Metrics[0].Name)
+		assert.Equal(t, "qce_cvm_cpuusage_p99", item.Metrics[1].Name)
+		assert.Equal(t, "p99", item.Metrics[1].Statistic)
+		assert.NotEmpty(t, item.Metrics[1].Help)
+	}
+}
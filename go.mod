@@ -7,6 +7,7 @@ require (
 	github.com/prometheus/client_golang v1.12.2-0.20220630150036-810fcb46abcd
 	github.com/prometheus/client_model v0.2.0
 	github.com/prometheus/common v0.35.0
+	github.com/prometheus/exporter-toolkit v0.7.1
 	github.com/stretchr/testify v1.6.1
 	github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs v1.0.899
 	github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cdb v1.0.900
@@ -39,5 +40,4 @@ require (
 	golang.org/x/time v0.0.0-20200630173020-3af7569d3a1e
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 	gopkg.in/yaml.v2 v2.4.0
-
 )
@@ -1,9 +1,11 @@
 package client
 
 import (
+	"crypto/tls"
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
@@ -43,253 +45,260 @@ import (
 )
 
 func NewMonitorClient(cred common.CredentialIface, conf *config.TencentConfig, region string) (*monitor.Client, error) {
+	cli, err := monitor.NewClient(cred, region, newClientProfile(conf, "monitor"))
+	if err != nil {
+		return nil, err
+	}
+	cli.WithHttpTransport(newTransport(conf, "monitor"))
+	return cli, nil
+}
+
+// 按client配置或是否内网生成各产品的ClientProfile
+func newClientProfile(conf *config.TencentConfig, service string) *tcprofile.ClientProfile {
 	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "monitor.internal.tencentcloudapi.com"
+	if endpoint := conf.Client.GetEndpoint(service); endpoint != "" {
+		// client.endpoint所有产品使用同一个地址, 产品名在签名中
+		u, _ := url.Parse(endpoint)
+		cpf.HttpProfile.Scheme = strings.ToUpper(u.Scheme)
+		cpf.HttpProfile.Endpoint = u.Host
+	} else if conf.Credential.IsInternal == true {
+		cpf.HttpProfile.Endpoint = service + ".internal.tencentcloudapi.com"
 	} else {
-		cpf.HttpProfile.Endpoint = "monitor.tencentcloudapi.com"
+		cpf.HttpProfile.Endpoint = service + ".tencentcloudapi.com"
 	}
-	return newClient(cred, region, cpf)
+	// 限速、请求统计和录制回放从TC3签名的请求头中获取产品名和接口名
+	cpf.SignMethod = "TC3-HMAC-SHA256"
+	// 整体超时由retryTransport按单次请求控制, 不使用http.Client.Timeout
+	cpf.HttpProfile.ReqTimeout = 0
+	return cpf
 }
 
-func newClient(
-	credential common.CredentialIface,
-	region string,
-	clientProfile *tcprofile.ClientProfile,
-) (client *monitor.Client, err error) {
-	client = &monitor.Client{}
-	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
+// 所有sdk client共用的http transport, 依次为重试、限速、请求统计、录制回放、http连接,
+// 代理、CA、连接池和单次请求超时来自client配置
+func newTransport(conf *config.TencentConfig, service string) http.RoundTripper {
+	apiLimiters.configure(conf)
+
+	proxy := http.ProxyFromEnvironment
+	if conf.Client.Proxy != "" {
+		// 配置检查时已校验格式
+		u, _ := url.Parse(conf.Client.Proxy)
+		proxy = http.ProxyURL(u)
+	}
+	base := &http.Transport{
+		Proxy: proxy,
 		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
+			Timeout:   conf.Client.GetDialTimeout(),
 			KeepAlive: 5 * time.Second,
 		}).DialContext,
+		TLSClientConfig: &tls.Config{
+			RootCAs: conf.Client.RootCAs(),
+		},
 		ForceAttemptHTTP2:     true,
 		MaxIdleConns:          0,
+		MaxIdleConnsPerHost:   conf.Client.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       conf.Client.MaxConnsPerHost,
 		IdleConnTimeout:       30 * time.Second,
-		TLSHandshakeTimeout:   30 * time.Second,
+		TLSHandshakeTimeout:   conf.Client.GetDialTimeout(),
 		ExpectContinueTimeout: 1 * time.Second,
 	}
-	clientProfile.HttpProfile.ReqTimeout = 5
-	client.Init(region).
-		WithCredential(credential).
-		WithProfile(clientProfile).WithHttpTransport(transport)
-	return
+	return newRetryTransport(newLimitTransport(newInstrumentTransport(wrapTraffic(base)), apiLimiters), DefaultRetryPolicy, conf.Client.GetTimeout(service))
 }
 
 func NewMongodbClient(cred common.CredentialIface, conf *config.TencentConfig) (*mongodb.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "mongodb.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "mongodb.tencentcloudapi.com"
+	cli, err := mongodb.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "mongodb"))
+	if err != nil {
+		return nil, err
 	}
-	return mongodb.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "mongodb"))
+	return cli, nil
 }
 
 func NewCdbClient(cred common.CredentialIface, conf *config.TencentConfig) (*cdb.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "cdb.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "cdb.tencentcloudapi.com"
+	cli, err := cdb.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "cdb"))
+	if err != nil {
+		return nil, err
 	}
-	return cdb.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "cdb"))
+	return cli, nil
 }
 
 func NewCvmClient(cred common.CredentialIface, conf *config.TencentConfig) (*cvm.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "cvm.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "cvm.tencentcloudapi.com"
+	cli, err := cvm.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "cvm"))
+	if err != nil {
+		return nil, err
 	}
-	return cvm.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "cvm"))
+	return cli, nil
 }
 
 func NewRedisClient(cred common.CredentialIface, conf *config.TencentConfig) (*redis.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "redis.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "redis.tencentcloudapi.com"
+	cli, err := redis.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "redis"))
+	if err != nil {
+		return nil, err
 	}
-	return redis.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "redis"))
+	return cli, nil
 }
 
 func NewDcClient(cred common.CredentialIface, conf *config.TencentConfig) (*dc.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "dc.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "dc.tencentcloudapi.com"
+	cli, err := dc.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "dc"))
+	if err != nil {
+		return nil, err
 	}
-	return dc.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "dc"))
+	return cli, nil
 }
 
 func NewClbClient(cred common.CredentialIface, conf *config.TencentConfig) (*clb.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "clb.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "clb.tencentcloudapi.com"
+	cli, err := clb.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "clb"))
+	if err != nil {
+		return nil, err
 	}
-	return clb.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "clb"))
+	return cli, nil
 }
 
 func NewVpvClient(cred common.CredentialIface, conf *config.TencentConfig) (*vpc.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "vpc.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "vpc.tencentcloudapi.com"
+	cli, err := vpc.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "vpc"))
+	if err != nil {
+		return nil, err
 	}
-	return vpc.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "vpc"))
+	return cli, nil
 }
 
 func NewCbsClient(cred common.CredentialIface, conf *config.TencentConfig) (*cbs.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "cbs.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "cbs.tencentcloudapi.com"
+	cli, err := cbs.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "cbs"))
+	if err != nil {
+		return nil, err
 	}
-	return cbs.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "cbs"))
+	return cli, nil
 }
 
 func NewSqlServerClient(cred common.CredentialIface, conf *config.TencentConfig) (*sqlserver.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "sqlserver.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "sqlserver.tencentcloudapi.com"
+	cli, err := sqlserver.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "sqlserver"))
+	if err != nil {
+		return nil, err
 	}
-	return sqlserver.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "sqlserver"))
+	return cli, nil
 }
 
 func NewMariaDBClient(cred common.CredentialIface, conf *config.TencentConfig) (*mariadb.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "mariadb.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "mariadb.tencentcloudapi.com"
+	cli, err := mariadb.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "mariadb"))
+	if err != nil {
+		return nil, err
 	}
-	return mariadb.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "mariadb"))
+	return cli, nil
 }
 
 func NewESClient(cred common.CredentialIface, conf *config.TencentConfig) (*es.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "es.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "es.tencentcloudapi.com"
+	cli, err := es.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "es"))
+	if err != nil {
+		return nil, err
 	}
-	return es.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "es"))
+	return cli, nil
 }
 
 func NewCMQClient(cred common.CredentialIface, conf *config.TencentConfig) (*cmq.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "cmq.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "cmq.tencentcloudapi.com"
+	cli, err := cmq.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "cmq"))
+	if err != nil {
+		return nil, err
 	}
-	return cmq.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "cmq"))
+	return cli, nil
 }
 
 func NewPGClient(cred common.CredentialIface, conf *config.TencentConfig) (*pg.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "postgres.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "postgres.tencentcloudapi.com"
+	cli, err := pg.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "postgres"))
+	if err != nil {
+		return nil, err
 	}
-	return pg.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "postgres"))
+	return cli, nil
 }
 
 func NewMemcacheClient(cred common.CredentialIface, conf *config.TencentConfig) (*memcached.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "memcached.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "memcached.tencentcloudapi.com"
+	cli, err := memcached.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "memcached"))
+	if err != nil {
+		return nil, err
 	}
-	return memcached.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "memcached"))
+	return cli, nil
 }
 
 func NewLighthouseClient(cred common.CredentialIface, conf *config.TencentConfig) (*lh.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "lighthouse.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "lighthouse.tencentcloudapi.com"
+	cli, err := lh.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "lighthouse"))
+	if err != nil {
+		return nil, err
 	}
-	return lh.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "lighthouse"))
+	return cli, nil
 }
 
 func NewKafkaClient(cred common.CredentialIface, conf *config.TencentConfig) (*kafka.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "ckafka.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "ckafka.tencentcloudapi.com"
+	cli, err := kafka.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "ckafka"))
+	if err != nil {
+		return nil, err
 	}
-	return kafka.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "ckafka"))
+	return cli, nil
 }
 
 func NewDCDBClient(cred common.CredentialIface, conf *config.TencentConfig) (*dcdb.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "dcdb.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "dcdb.tencentcloudapi.com"
+	cli, err := dcdb.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "dcdb"))
+	if err != nil {
+		return nil, err
 	}
-	return dcdb.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "dcdb"))
+	return cli, nil
 }
 
 func NewRocketMQClient(cred common.CredentialIface, conf *config.TencentConfig) (*rocketmq.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "tdmq.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "tdmq.tencentcloudapi.com"
+	cli, err := rocketmq.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "tdmq"))
+	if err != nil {
+		return nil, err
 	}
-	return rocketmq.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "tdmq"))
+	return cli, nil
 }
 
 func NewTseClient(cred common.CredentialIface, conf *config.TencentConfig) (*tse.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "tse.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "tse.tencentcloudapi.com"
+	cli, err := tse.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "tse"))
+	if err != nil {
+		return nil, err
 	}
-	return tse.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "tse"))
+	return cli, nil
 }
 
 func NewCynosdbClient(cred common.CredentialIface, conf *config.TencentConfig) (*cynosdb.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "cynosdb.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "cynosdb.tencentcloudapi.com"
+	cli, err := cynosdb.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "cynosdb"))
+	if err != nil {
+		return nil, err
 	}
-	return cynosdb.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "cynosdb"))
+	return cli, nil
 }
 
 func NewCdnClient(cred common.CredentialIface, conf *config.TencentConfig) (*cdn.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "cdn.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "cdn.tencentcloudapi.com"
+	cli, err := cdn.NewClient(cred, "", newClientProfile(conf, "cdn"))
+	if err != nil {
+		return nil, err
 	}
-	return cdn.NewClient(cred, "", cpf)
+	cli.WithHttpTransport(newTransport(conf, "cdn"))
+	return cli, nil
 }
 
 func NewCosClient(cred common.CredentialIface, conf *config.TencentConfig) (*cos.Client, error) {
 	// 用于Get Service 查询, service域名暂时只支持外网
 	su, _ := url.Parse("http://cos." + conf.Credential.Region + ".myqcloud.com")
+	if endpoint := conf.Client.GetEndpoint("cos"); endpoint != "" {
+		su, _ = url.Parse(endpoint)
+	}
 	b := &cos.BaseURL{BucketURL: nil, ServiceURL: su}
 	client := &cos.Client{}
 	if conf.Credential.Role == "" {
@@ -297,11 +306,14 @@ func NewCosClient(cred common.CredentialIface, conf *config.TencentConfig) (*cos
 			Transport: &cos.AuthorizationTransport{
 				SecretID:  conf.Credential.AccessKey,
 				SecretKey: conf.Credential.SecretKey,
+				Transport: newTransport(conf, "cos"),
 			},
 		})
 	} else {
+		credTransport := common.NewCredentialTransport(cred.GetRole())
+		credTransport.Transport = newTransport(conf, "cos")
 		client = cos.NewClient(b, &http.Client{
-			Transport: common.NewCredentialTransport(cred.GetRole()),
+			Transport: credTransport,
 		})
 	}
 
@@ -309,61 +321,54 @@ func NewCosClient(cred common.CredentialIface, conf *config.TencentConfig) (*cos
 }
 
 func NewDTSClient(cred common.CredentialIface, conf *config.TencentConfig) (*dts.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "dts.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "dts.tencentcloudapi.com"
+	cli, err := dts.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "dts"))
+	if err != nil {
+		return nil, err
 	}
-	return dts.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "dts"))
+	return cli, nil
 }
+
 func NewDTSNewClient(cred common.CredentialIface, conf *config.TencentConfig) (*dtsNew.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "dts.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "dts.tencentcloudapi.com"
+	cli, err := dtsNew.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "dts"))
+	if err != nil {
+		return nil, err
 	}
-	return dtsNew.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "dts"))
+	return cli, nil
 }
 
 func NewGAAPClient(cred common.CredentialIface, conf *config.TencentConfig) (*gaap.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "gaap.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "gaap.tencentcloudapi.com"
+	cli, err := gaap.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "gaap"))
+	if err != nil {
+		return nil, err
 	}
-	return gaap.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "gaap"))
+	return cli, nil
 }
 
 func NewGAAPCommonClient(cred common.CredentialIface, conf *config.TencentConfig) *tccommon.Client {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "gaap.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "gaap.tencentcloudapi.com"
-	}
+	cpf := newClientProfile(conf, "gaap")
 	cpf.HttpProfile.ReqMethod = "POST"
-	return tccommon.NewCommonClient(cred, tcregions.Guangzhou, cpf)
+	cli := tccommon.NewCommonClient(cred, tcregions.Guangzhou, cpf)
+	cli.WithHttpTransport(newTransport(conf, "gaap"))
+	return cli
 }
 
 func NewWafClient(cred common.CredentialIface, conf *config.TencentConfig) (*waf.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "waf.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "waf.tencentcloudapi.com"
+	cli, err := waf.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "waf"))
+	if err != nil {
+		return nil, err
 	}
-	return waf.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "waf"))
+	return cli, nil
 }
 
 func NewCfsClient(cred common.CredentialIface, conf *config.TencentConfig) (*cfs.Client, error) {
-	cpf := tcprofile.NewClientProfile()
-	if conf.Credential.IsInternal == true {
-		cpf.HttpProfile.Endpoint = "cfs.internal.tencentcloudapi.com"
-	} else {
-		cpf.HttpProfile.Endpoint = "cfs.tencentcloudapi.com"
+	cli, err := cfs.NewClient(cred, conf.Credential.Region, newClientProfile(conf, "cfs"))
+	if err != nil {
+		return nil, err
 	}
-	return cfs.NewClient(cred, conf.Credential.Region, cpf)
+	cli.WithHttpTransport(newTransport(conf, "cfs"))
+	return cli, nil
 }
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	cvm "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cvm/v20170312"
+
+	"tencentcloud-exporter/pkg/common"
+	"tencentcloud-exporter/pkg/config"
+	"tencentcloud-exporter/pkg/fakecloud"
+)
+
+func loadClientConfig(t *testing.T, s *fakecloud.Server, client string) *config.TencentConfig {
+	content := fmt.Sprintf(`credential:
+  access_key: %s
+  secret_key: %s
+  region: ap-guangzhou
+client:
+%s
+`, s.SecretId, s.SecretKey, client)
+	filename := filepath.Join(t.TempDir(), "qcloud.yml")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := config.NewConfig()
+	if err := conf.LoadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	return conf
+}
+
+func describeInstances(t *testing.T, s *fakecloud.Server, conf *config.TencentConfig) error {
+	cli, err := NewCvmClient(&common.Credential{SecretId: s.SecretId, SecretKey: s.SecretKey}, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cli.DescribeInstances(cvm.NewDescribeInstancesRequest())
+	return err
+}
+
+func Test_ClientProxy(t *testing.T) {
+	s := fakecloud.NewServer("AKIDproxy", "proxy-secret")
+	defer s.Close()
+	s.HandleList("cvm", "DescribeInstances", "InstanceSet", []interface{}{})
+
+	// 请求公有云域名, 经过代理发往fakecloud; https需要CONNECT, 这里使用http
+	conf := loadClientConfig(t, s, "  endpoints:\n    cvm: http://cvm.tencentcloudapi.com\n  proxy: "+s.URL())
+	assert.NoError(t, describeInstances(t, s, conf))
+	assert.Len(t, s.Requests("cvm", "DescribeInstances"), 1)
+}
+
+func Test_ClientCAFile(t *testing.T) {
+	s := fakecloud.NewServer("AKIDtls", "tls-secret")
+	defer s.Close()
+	s.HandleList("cvm", "DescribeInstances", "InstanceSet", []interface{}{})
+	ts := httptest.NewUnstartedServer(s)
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := loadClientConfig(t, s, fmt.Sprintf("  endpoints:\n    cvm: %s\n  timeout_seconds: 1", ts.URL))
+	assert.Error(t, describeInstances(t, s, conf), "self-signed certificate should not be trusted")
+
+	conf = loadClientConfig(t, s, fmt.Sprintf("  endpoints:\n    cvm: %s\n  ca_file: %s", ts.URL, caFile))
+	assert.NoError(t, describeInstances(t, s, conf))
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 统计每次发往云API的请求, 位于重试层之下, 每次重试都单独计数, 与计费口径一致
+type instrumentTransport struct {
+	next http.RoundTripper
+}
+
+func (t *instrumentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	service := serviceName(req)
+	action := apiName(req)
+	region := req.Header.Get("X-TC-Region")
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		code := codeNetworkError
+		if req.Context().Err() != nil {
+			code = codeCanceled
+		}
+		apiRequestsTotal.WithLabelValues(service, action, region, code).Inc()
+		apiRequestDuration.WithLabelValues(service, action, region).Observe(time.Since(start).Seconds())
+		return nil, err
+	}
+	content, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	apiRequestDuration.WithLabelValues(service, action, region).Observe(time.Since(start).Seconds())
+	if err != nil {
+		apiRequestsTotal.WithLabelValues(service, action, region, codeNetworkError).Inc()
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(content))
+
+	code := responseCode(resp, content)
+	apiRequestsTotal.WithLabelValues(service, action, region, code).Inc()
+	if action == "GetMonitorData" && code == codeOK {
+		apiDatapointsReturnedTotal.WithLabelValues(requestNamespace(req), region).Add(float64(countDatapoints(content)))
+	}
+	return resp, nil
+}
+
+// 优先使用签名中的产品名, 配置了client.endpoint时域名不包含产品名;
+// 否则域名的第一段即产品名, 如monitor.tencentcloudapi.com
+func serviceName(req *http.Request) string {
+	authorization := req.Header.Get("Authorization")
+	if service := credentialScopeService(authorization); service != "" {
+		return service
+	}
+	// COS的签名, 如q-sign-algorithm=sha1&q-ak=xxx
+	if strings.HasPrefix(authorization, "q-sign-algorithm=") {
+		return "cos"
+	}
+	host := req.URL.Hostname()
+	if idx := strings.Index(host, "."); idx > 0 {
+		return host[:idx]
+	}
+	return host
+}
+
+// TC3签名的Credential=SecretId/Date/Service/tc3_request
+func credentialScopeService(authorization string) string {
+	idx := strings.Index(authorization, "Credential=")
+	if idx < 0 {
+		return ""
+	}
+	scope := authorization[idx+len("Credential="):]
+	if end := strings.Index(scope, ","); end >= 0 {
+		scope = scope[:end]
+	}
+	items := strings.Split(scope, "/")
+	if len(items) != 4 {
+		return ""
+	}
+	return items[2]
+}
+
+// GetMonitorData请求体中的Namespace, 用于按产品统计返回的数据点
+func requestNamespace(req *http.Request) string {
+	if req.GetBody == nil {
+		return ""
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+	var params struct {
+		Namespace string
+	}
+	if err := json.NewDecoder(body).Decode(&params); err != nil {
+		return ""
+	}
+	return params.Namespace
+}
+
+func countDatapoints(content []byte) int {
+	var body struct {
+		Response struct {
+			DataPoints []struct {
+				Values []json.RawMessage
+			}
+		}
+	}
+	if err := json.Unmarshal(content, &body); err != nil {
+		return 0
+	}
+	var n int
+	for _, dp := range body.Response.DataPoints {
+		n += len(dp.Values)
+	}
+	return n
+}
+
+func newInstrumentTransport(next http.RoundTripper) http.RoundTripper {
+	return &instrumentTransport{next: next}
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestApiRequest(t *testing.T, service string, action string, body string) *http.Request {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "http://127.0.0.1/", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "TC3-HMAC-SHA256 Credential=AKID/2024-01-01/"+service+"/tc3_request, SignedHeaders=content-type;host, Signature=xxx")
+	req.Header.Set("X-TC-Action", action)
+	req.Header.Set("X-TC-Region", "ap-guangzhou")
+	return req
+}
+
+func Test_InstrumentTransport(t *testing.T) {
+	apiRequestsTotal.Reset()
+	apiRequestDuration.Reset()
+	apiDatapointsReturnedTotal.Reset()
+
+	requests := []struct {
+		service  string
+		action   string
+		body     string
+		response func() (*http.Response, error)
+	}{
+		{"monitor", "GetMonitorData", `{"Namespace":"QCE/CVM"}`,
+			stubResponse(200, `{"Response":{"DataPoints":[{"Values":[1,2]},{"Values":[3]}],"RequestId":"1"}}`)},
+		{"monitor", "GetMonitorData", `{"Namespace":"QCE/CVM"}`, stubErrorCode("RequestLimitExceeded")},
+		{"cvm", "DescribeInstances", `{}`, stubErrorCode("InvalidParameter")},
+		{"cvm", "DescribeInstances", `{}`, stubNetworkError},
+		{"cvm", "DescribeInstances", `{}`, stubResponse(502, "bad gateway")},
+		{"cvm", "DescribeInstances", `{}`, stubResponse(200, `{"Response":{"RequestId":"1"}}`)},
+	}
+	for _, r := range requests {
+		stub := &stubRoundTripper{responses: []func() (*http.Response, error){r.response}}
+		newInstrumentTransport(stub).RoundTrip(newTestApiRequest(t, r.service, r.action, r.body))
+	}
+
+	expected := `
+# HELP tcm_api_requests_total qcloud_exporter: Number of requests sent to Tencent Cloud API, including retries.
+# TYPE tcm_api_requests_total counter
+tcm_api_requests_total{action="DescribeInstances",code="HTTP502",region="ap-guangzhou",service="cvm"} 1
+tcm_api_requests_total{action="DescribeInstances",code="InvalidParameter",region="ap-guangzhou",service="cvm"} 1
+tcm_api_requests_total{action="DescribeInstances",code="NetworkError",region="ap-guangzhou",service="cvm"} 1
+tcm_api_requests_total{action="DescribeInstances",code="OK",region="ap-guangzhou",service="cvm"} 1
+tcm_api_requests_total{action="GetMonitorData",code="OK",region="ap-guangzhou",service="monitor"} 1
+tcm_api_requests_total{action="GetMonitorData",code="RequestLimitExceeded",region="ap-guangzhou",service="monitor"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(apiRequestsTotal, strings.NewReader(expected)))
+
+	// 只统计成功的GetMonitorData返回的数据点
+	expected = `
+# HELP tcm_api_datapoints_returned_total qcloud_exporter: Number of data points returned by GetMonitorData.
+# TYPE tcm_api_datapoints_returned_total counter
+tcm_api_datapoints_returned_total{namespace="QCE/CVM",region="ap-guangzhou"} 3
+`
+	assert.NoError(t, testutil.CollectAndCompare(apiDatapointsReturnedTotal, strings.NewReader(expected)))
+
+	// 耗时按产品和接口统计, 失败的请求也计入
+	assert.Equal(t, 2, testutil.CollectAndCount(apiRequestDuration))
+	for _, c := range []struct {
+		service string
+		action  string
+		count   uint64
+	}{
+		{"monitor", "GetMonitorData", 2},
+		{"cvm", "DescribeInstances", 4},
+	} {
+		m := &dto.Metric{}
+		if err := apiRequestDuration.WithLabelValues(c.service, c.action, "ap-guangzhou").(prometheus.Histogram).Write(m); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, c.count, m.GetHistogram().GetSampleCount(), c.action)
+	}
+}
+
+func Test_InstrumentRetries(t *testing.T) {
+	apiRequestsTotal.Reset()
+	apiRetriesTotal.Reset()
+
+	stub := &stubRoundTripper{responses: []func() (*http.Response, error){
+		stubErrorCode("RequestLimitExceeded"),
+		stubErrorCode("InternalError"),
+		stubResponse(200, `{"Response":{"RequestId":"1"}}`),
+	}}
+	transport := newRetryTransport(newInstrumentTransport(stub), testRetryPolicy, 0)
+	_, err := transport.RoundTrip(newTestApiRequest(t, "cvm", "DescribeInstances", `{}`))
+	assert.NoError(t, err)
+
+	// 每次重试单独计数
+	expected := `
+# HELP tcm_api_requests_total qcloud_exporter: Number of requests sent to Tencent Cloud API, including retries.
+# TYPE tcm_api_requests_total counter
+tcm_api_requests_total{action="DescribeInstances",code="InternalError",region="ap-guangzhou",service="cvm"} 1
+tcm_api_requests_total{action="DescribeInstances",code="OK",region="ap-guangzhou",service="cvm"} 1
+tcm_api_requests_total{action="DescribeInstances",code="RequestLimitExceeded",region="ap-guangzhou",service="cvm"} 1
+# HELP tcm_api_retries_total qcloud_exporter: Number of retried Tencent Cloud API requests.
+# TYPE tcm_api_retries_total counter
+tcm_api_retries_total{api="DescribeInstances",code="InternalError"} 1
+tcm_api_retries_total{api="DescribeInstances",code="RequestLimitExceeded"} 1
+`
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(apiRequestsTotal, apiRetriesTotal)
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected)))
+}
+
+func Test_serviceName(t *testing.T) {
+	req := newTestApiRequest(t, "monitor", "GetMonitorData", `{}`)
+	assert.Equal(t, "monitor", serviceName(req))
+
+	// 没有TC3签名时使用域名的第一段
+	req, _ = http.NewRequest(http.MethodGet, "https://cvm.tencentcloudapi.com/", nil)
+	assert.Equal(t, "cvm", serviceName(req))
+	assert.Equal(t, http.MethodGet, apiName(req))
+
+	req.Header.Set("Authorization", "q-sign-algorithm=sha1&q-ak=AKID")
+	assert.Equal(t, "cos", serviceName(req))
+}
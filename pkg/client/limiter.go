@@ -0,0 +1,171 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"tencentcloud-exporter/pkg/config"
+)
+
+const (
+	// 触发限频后速率减半, 最低降到配置值的10%
+	limiterSlowdownRatio = 0.5
+	limiterMinRatio      = 0.1
+	// 请求成功后每次恢复配置值的5%, 直到配置值
+	limiterRecoverRatio = 0.05
+
+	limiterDefaultKey = "default"
+)
+
+// 带等待时间统计和自动降速的限速器
+type Limiter struct {
+	name    string
+	limit   float64 // 配置的速率
+	current float64 // 当前速率, 触发限频后低于配置值
+	limiter *rate.Limiter
+	mu      sync.Mutex
+}
+
+func (l *Limiter) Wait(ctx context.Context) error {
+	start := time.Now()
+	err := l.limiter.Wait(ctx)
+	apiLimiterWaitSeconds.WithLabelValues(l.name).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// 乘性减速
+func (l *Limiter) slowdown() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	current := l.current * limiterSlowdownRatio
+	if floor := l.limit * limiterMinRatio; current < floor {
+		current = floor
+	}
+	if current < l.current {
+		l.setCurrent(current)
+		apiLimiterSlowdownsTotal.WithLabelValues(l.name).Inc()
+	}
+}
+
+// 加性恢复
+func (l *Limiter) recover() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current >= l.limit {
+		return
+	}
+	current := l.current + l.limit*limiterRecoverRatio
+	if current > l.limit {
+		current = l.limit
+	}
+	l.setCurrent(current)
+}
+
+func (l *Limiter) setCurrent(current float64) {
+	l.current = current
+	l.limiter.SetLimit(rate.Limit(current))
+	apiLimiterRate.WithLabelValues(l.name).Set(current)
+}
+
+func NewLimiter(name string, limit float64) *Limiter {
+	l := &Limiter{
+		name:    name,
+		limit:   limit,
+		current: limit,
+		limiter: rate.NewLimiter(rate.Limit(limit), 1),
+	}
+	apiLimiterRate.WithLabelValues(name).Set(limit)
+	return l
+}
+
+// 按 service/action 区分的限速器, 所有sdk client共用
+type limiterRegistry struct {
+	limits   map[string]float64
+	limiters map[string]*Limiter
+	mu       sync.Mutex
+}
+
+// 依次按 service/action、service、default 查找配置的速率
+func (r *limiterRegistry) getLimit(service string, action string) float64 {
+	for _, key := range []string{service + "/" + action, service, limiterDefaultKey} {
+		if limit, ok := r.limits[strings.ToLower(key)]; ok {
+			return limit
+		}
+	}
+	return config.DefaultApiRateLimit
+}
+
+func (r *limiterRegistry) get(service string, action string) *Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := service + "/" + action
+	l, ok := r.limiters[key]
+	if !ok {
+		l = NewLimiter(key, r.getLimit(service, action))
+		r.limiters[key] = l
+	}
+	return l
+}
+
+func (r *limiterRegistry) configure(conf *config.TencentConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	limits := map[string]float64{
+		// 兼容rate_limit配置
+		"monitor/getmonitordata": conf.RateLimit,
+	}
+	for key, limit := range conf.ApiRateLimits {
+		limits[strings.ToLower(key)] = limit
+	}
+	r.limits = limits
+}
+
+var apiLimiters = &limiterRegistry{
+	limits:   map[string]float64{},
+	limiters: map[string]*Limiter{},
+}
+
+// 位于重试层之下, 每次重试都要重新获取令牌, 观察到限频错误时自动降速
+type limitTransport struct {
+	next     http.RoundTripper
+	registry *limiterRegistry
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	l := t.registry.get(serviceName(req), apiName(req))
+	if err := l.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(content))
+
+	code := responseCode(resp, content)
+	if code == "RequestLimitExceeded" || strings.HasPrefix(code, "RequestLimitExceeded.") {
+		l.slowdown()
+	} else if code == codeOK {
+		l.recover()
+	}
+	return resp, nil
+}
+
+func newLimitTransport(next http.RoundTripper, registry *limiterRegistry) http.RoundTripper {
+	return &limitTransport{
+		next:     next,
+		registry: registry,
+	}
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+
+	"tencentcloud-exporter/pkg/config"
+)
+
+func Test_LimiterSlowdownAndRecover(t *testing.T) {
+	apiLimiterSlowdownsTotal.Reset()
+	l := NewLimiter("test/slowdown", 1000)
+	// 每次减半, 最低到配置值的10%
+	for _, want := range []float64{500, 250, 125, 100, 100} {
+		l.slowdown()
+		assert.Equal(t, want, l.current)
+		assert.Equal(t, rate.Limit(want), l.limiter.Limit())
+	}
+	assert.Equal(t, float64(4), testutil.ToFloat64(apiLimiterSlowdownsTotal.WithLabelValues("test/slowdown")))
+
+	// 每次成功恢复配置值的5%, 不超过配置值
+	for i := 1; i <= 18; i++ {
+		l.recover()
+		assert.Equal(t, 100+float64(i)*50, l.current)
+	}
+	l.recover()
+	assert.Equal(t, float64(1000), l.current)
+	l.recover()
+	assert.Equal(t, float64(1000), l.current)
+	assert.Equal(t, rate.Limit(1000), l.limiter.Limit())
+	assert.Equal(t, float64(1000), testutil.ToFloat64(apiLimiterRate.WithLabelValues("test/slowdown")))
+}
+
+func Test_LimitTransport(t *testing.T) {
+	registry := &limiterRegistry{
+		limits:   map[string]float64{"cvm/describeinstances": 1000},
+		limiters: map[string]*Limiter{},
+	}
+	stub := &stubRoundTripper{responses: []func() (*http.Response, error){
+		stubErrorCode("RequestLimitExceeded"),
+		stubErrorCode("RequestLimitExceeded.UinLimitExceeded"),
+		stubErrorCode("InternalError"),
+		stubResponse(502, "bad gateway"),
+		stubResponse(200, `{"Response":{"RequestId":"1"}}`),
+	}}
+	transport := newLimitTransport(stub, registry)
+	// 限频错误减速, 其他错误不影响, 成功后恢复
+	for _, want := range []float64{500, 250, 250, 250, 300, 350} {
+		_, err := transport.RoundTrip(newTestApiRequest(t, "cvm", "DescribeInstances", `{}`))
+		assert.NoError(t, err)
+		assert.Equal(t, want, registry.get("cvm", "DescribeInstances").current)
+	}
+	// 不同接口的限速器互不影响
+	assert.Equal(t, float64(config.DefaultApiRateLimit), registry.get("cvm", "DescribeRegions").current)
+}
+
+func Test_limiterRegistryGetLimit(t *testing.T) {
+	registry := &limiterRegistry{
+		limits: map[string]float64{
+			"monitor/getmonitordata": 20,
+			"cvm":                    5,
+			"default":                8,
+		},
+		limiters: map[string]*Limiter{},
+	}
+	assert.Equal(t, float64(20), registry.getLimit("monitor", "GetMonitorData"))
+	assert.Equal(t, float64(8), registry.getLimit("monitor", "DescribeBaseMetrics"))
+	assert.Equal(t, float64(5), registry.getLimit("cvm", "DescribeInstances"))
+
+	delete(registry.limits, "default")
+	assert.Equal(t, float64(config.DefaultApiRateLimit), registry.getLimit("monitor", "DescribeBaseMetrics"))
+}
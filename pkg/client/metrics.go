@@ -0,0 +1,90 @@
+package client
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "tcm"
+
+var (
+	apiRetriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_retries_total",
+			Help:      "qcloud_exporter: Number of retried Tencent Cloud API requests.",
+		},
+		[]string{"api", "code"},
+	)
+	apiRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_requests_total",
+			Help:      "qcloud_exporter: Number of requests sent to Tencent Cloud API, including retries.",
+		},
+		[]string{"service", "action", "region", "code"},
+	)
+	apiRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_request_duration_seconds",
+			Help:      "qcloud_exporter: Duration of requests sent to Tencent Cloud API.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"service", "action", "region"},
+	)
+	apiDatapointsReturnedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_datapoints_returned_total",
+			Help:      "qcloud_exporter: Number of data points returned by GetMonitorData.",
+		},
+		[]string{"namespace", "region"},
+	)
+	apiLimiterWaitSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_limiter_wait_seconds",
+			Help:      "qcloud_exporter: Time spent waiting for rate limiters before calling Tencent Cloud API.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"limiter"},
+	)
+	apiLimiterRate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_limiter_rate",
+			Help:      "qcloud_exporter: Current rate of rate limiters in requests per second.",
+		},
+		[]string{"limiter"},
+	)
+	apiLimiterSlowdownsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_limiter_slowdowns_total",
+			Help:      "qcloud_exporter: Number of automatic slowdowns caused by RequestLimitExceeded.",
+		},
+		[]string{"limiter"},
+	)
+)
+
+// Describe 云API调用相关的自身指标, 由TcMonitorCollector一并导出
+func Describe(ch chan<- *prometheus.Desc) {
+	apiRetriesTotal.Describe(ch)
+	apiRequestsTotal.Describe(ch)
+	apiRequestDuration.Describe(ch)
+	apiDatapointsReturnedTotal.Describe(ch)
+	apiLimiterWaitSeconds.Describe(ch)
+	apiLimiterRate.Describe(ch)
+	apiLimiterSlowdownsTotal.Describe(ch)
+}
+
+// Collect 云API调用相关的自身指标, 由TcMonitorCollector一并导出
+func Collect(ch chan<- prometheus.Metric) {
+	apiRetriesTotal.Collect(ch)
+	apiRequestsTotal.Collect(ch)
+	apiRequestDuration.Collect(ch)
+	apiDatapointsReturnedTotal.Collect(ch)
+	apiLimiterWaitSeconds.Collect(ch)
+	apiLimiterRate.Collect(ch)
+	apiLimiterSlowdownsTotal.Collect(ch)
+}
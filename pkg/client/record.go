@@ -0,0 +1,230 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 录制文件中替换凭证的值
+const redacted = "REDACTED"
+
+// 包含凭证的请求头, 录制时替换为REDACTED
+var credentialHeaders = []string{"Authorization", "X-TC-Token", "X-Cos-Security-Token"}
+
+// 请求体中每次请求都不同的参数, 回放时不参与匹配
+var volatileParams = []string{"StartTime", "EndTime"}
+
+// 一次云API请求和响应, 每个请求保存为录制目录下的一个json文件
+type Exchange struct {
+	Service        string      `json:"service"`
+	Action         string      `json:"action"`
+	Region         string      `json:"region"`
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	RequestHeader  http.Header `json:"request_header"`
+	RequestBody    string      `json:"request_body"`
+	StatusCode     int         `json:"status_code"`
+	ResponseHeader http.Header `json:"response_header"`
+	ResponseBody   string      `json:"response_body"`
+}
+
+// 回放时匹配请求的key, 请求体去掉查询时间等参数
+func (e *Exchange) key() string {
+	return strings.Join([]string{e.Service, e.Action, e.Region, normalizeBody(e.RequestBody)}, " ")
+}
+
+func normalizeBody(body string) string {
+	var params map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &params); err != nil {
+		return body
+	}
+	for _, p := range volatileParams {
+		delete(params, p)
+	}
+	// map序列化时key有序
+	b, err := json.Marshal(params)
+	if err != nil {
+		return body
+	}
+	return string(b)
+}
+
+func readRequest(req *http.Request) (*Exchange, error) {
+	e := &Exchange{
+		Service:       serviceName(req),
+		Action:        apiName(req),
+		Region:        req.Header.Get("X-TC-Region"),
+		Method:        req.Method,
+		URL:           req.URL.String(),
+		RequestHeader: req.Header.Clone(),
+	}
+	for _, h := range credentialHeaders {
+		if e.RequestHeader.Get(h) != "" {
+			e.RequestHeader.Set(h, redacted)
+		}
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		content, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(content))
+		e.RequestBody = string(content)
+	}
+	return e, nil
+}
+
+func (e *Exchange) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.ResponseHeader.Clone(),
+		Body:          io.NopCloser(strings.NewReader(e.ResponseBody)),
+		ContentLength: int64(len(e.ResponseBody)),
+		Request:       req,
+	}
+}
+
+// 将经过的请求和响应写入目录, 文件名为<序号>-<service>-<action>.json
+type recordTransport struct {
+	next http.RoundTripper
+	dir  string
+}
+
+// 所有client共用的录制序号
+var recordSeq uint64
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	e, err := readRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(content))
+	e.StatusCode = resp.StatusCode
+	e.ResponseHeader = resp.Header.Clone()
+	e.ResponseBody = string(content)
+
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	seq := atomic.AddUint64(&recordSeq, 1)
+	filename := filepath.Join(t.dir, fmt.Sprintf("%06d-%s-%s.json", seq, e.Service, e.Action))
+	if err := os.WriteFile(filename, b, 0600); err != nil {
+		return nil, fmt.Errorf("record api request fail, %s", err)
+	}
+	return resp, nil
+}
+
+// 按录制顺序返回匹配的响应, 超出录制次数时重复返回最后一次, 不访问网络
+type replayTransport struct {
+	mu        sync.Mutex
+	exchanges map[string][]*Exchange
+	served    map[string]int
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	e, err := readRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	key := e.key()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	exchanges := t.exchanges[key]
+	if len(exchanges) == 0 {
+		return nil, fmt.Errorf("no recorded response for %s.%s, region=%s, body=%s", e.Service, e.Action, e.Region, e.RequestBody)
+	}
+	i := t.served[key]
+	if i < len(exchanges)-1 {
+		t.served[key] = i + 1
+	}
+	return exchanges[i].response(req), nil
+}
+
+func loadReplayTransport(dir string) (*replayTransport, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recorded api requests in %s", dir)
+	}
+	// 文件名以序号开头, 排序后即录制顺序
+	sort.Strings(files)
+	t := &replayTransport{
+		exchanges: map[string][]*Exchange{},
+		served:    map[string]int{},
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		e := &Exchange{}
+		if err := json.Unmarshal(b, e); err != nil {
+			return nil, fmt.Errorf("load %s fail, %s", file, err)
+		}
+		key := e.key()
+		t.exchanges[key] = append(t.exchanges[key], e)
+	}
+	return t, nil
+}
+
+// 替换发往云API的http连接层, 为空时直接访问网络
+var apiTraffic struct {
+	record string
+	replay *replayTransport
+}
+
+// 将所有云API请求和响应录制到dir, 凭证替换为REDACTED, 需要在创建client之前调用
+func EnableRecord(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	apiTraffic.record = dir
+	return nil
+}
+
+// 使用dir中录制的响应代替云API, 不访问网络, 需要在创建client之前调用
+func EnableReplay(dir string) error {
+	t, err := loadReplayTransport(dir)
+	if err != nil {
+		return err
+	}
+	apiTraffic.replay = t
+	return nil
+}
+
+// 按录制或回放配置包装http连接层
+func wrapTraffic(base http.RoundTripper) http.RoundTripper {
+	if apiTraffic.replay != nil {
+		return apiTraffic.replay
+	}
+	if apiTraffic.record != "" {
+		return &recordTransport{next: base, dir: apiTraffic.record}
+	}
+	return base
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	tccommon "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+	monitor "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/monitor/v20180724"
+
+	"tencentcloud-exporter/pkg/common"
+	"tencentcloud-exporter/pkg/config"
+	"tencentcloud-exporter/pkg/fakecloud"
+)
+
+func Test_RecordAndReplay(t *testing.T) {
+	defer func() {
+		apiTraffic.record = ""
+		apiTraffic.replay = nil
+	}()
+	s := fakecloud.NewServer("AKIDrecord", "record-secret")
+	s.AddMetric(fakecloud.NewMetricSet("QCE/CVM", "CpuUsage", "%", "max", []int64{60}, []string{"InstanceId"}))
+	conf := config.NewConfig()
+	conf.Credential.Region = "ap-guangzhou"
+	conf.Client.Endpoint = s.URL()
+	cred := &common.Credential{SecretId: s.SecretId, SecretKey: s.SecretKey}
+
+	request := monitor.NewGetMonitorDataRequest()
+	request.Namespace = tccommon.StringPtr("QCE/CVM")
+	request.MetricName = tccommon.StringPtr("CpuUsage")
+	request.Period = tccommon.Uint64Ptr(60)
+	request.Instances = []*monitor.Instance{{Dimensions: []*monitor.Dimension{
+		{Name: tccommon.StringPtr("InstanceId"), Value: tccommon.StringPtr("ins-1")},
+	}}}
+	request.StartTime = tccommon.StringPtr("2024-01-01 00:00:00")
+	request.EndTime = tccommon.StringPtr("2024-01-01 00:05:00")
+
+	dir := t.TempDir()
+	assert.NoError(t, EnableRecord(dir))
+	cli, err := NewMonitorClient(cred, conf, "ap-guangzhou")
+	assert.NoError(t, err)
+	recorded, err := cli.GetMonitorData(request)
+	assert.NoError(t, err)
+	s.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.Len(t, files, 1)
+	b, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(string(b), s.SecretId), "secret id should be redacted")
+	assert.True(t, strings.Contains(string(b), redacted))
+
+	// 服务已关闭, 查询时间不同的请求也返回录制的响应
+	apiTraffic.record = ""
+	assert.NoError(t, EnableReplay(dir))
+	cli, err = NewMonitorClient(cred, conf, "ap-guangzhou")
+	assert.NoError(t, err)
+	request.StartTime = tccommon.StringPtr("2024-01-02 00:00:00")
+	request.EndTime = tccommon.StringPtr("2024-01-02 00:05:00")
+	replayed, err := cli.GetMonitorData(request)
+	assert.NoError(t, err)
+	assert.Equal(t, recorded.ToJsonString(), replayed.ToJsonString())
+
+	request.MetricName = tccommon.StringPtr("MemUsage")
+	_, err = cli.GetMonitorData(request)
+	assert.Error(t, err)
+}
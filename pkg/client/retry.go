@@ -0,0 +1,188 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	codeNetworkError = "NetworkError"
+	codeCanceled     = "Canceled"
+	codeOK           = "OK"
+)
+
+// 云API重试策略, 第n次重试前等待 min(BaseDelay*2^n, MaxDelay) 加随机抖动
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  200 * time.Millisecond,
+	MaxDelay:   5 * time.Second,
+}
+
+// 第attempt次重试前的等待时间, 在[delay/2, delay)之间随机
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << uint(attempt)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int63n(half))
+}
+
+// 限频、服务内部错误、5xx和网络错误可以重试, 参数错误、鉴权失败等重试也不会成功
+func IsRetryableCode(code string) bool {
+	switch {
+	case code == codeNetworkError:
+		return true
+	case code == "RequestLimitExceeded" || strings.HasPrefix(code, "RequestLimitExceeded."):
+		return true
+	case code == "InternalError" || strings.HasPrefix(code, "InternalError."):
+		return true
+	case strings.HasPrefix(code, "HTTP5"):
+		return true
+	}
+	return false
+}
+
+type retryHookKey struct{}
+
+// 请求重试前调用hook, 返回false时不再重试, 用于按实际发出的请求数计算调用预算
+func WithRetryHook(ctx context.Context, hook func() bool) context.Context {
+	return context.WithValue(ctx, retryHookKey{}, hook)
+}
+
+func retryHook(ctx context.Context) func() bool {
+	hook, _ := ctx.Value(retryHookKey{}).(func() bool)
+	return hook
+}
+
+// 在http层对云API请求做重试, 所有sdk client共用, 不需要每个调用方单独处理
+type retryTransport struct {
+	next       http.RoundTripper
+	policy     RetryPolicy
+	reqTimeout time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// body无法重放的请求不重试
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return t.next.RoundTrip(req)
+	}
+	ctx := req.Context()
+	api := apiName(req)
+	for attempt := 0; ; attempt++ {
+		resp, code, err := t.roundTripOnce(req)
+		if !IsRetryableCode(code) || attempt >= t.policy.MaxRetries {
+			return resp, err
+		}
+		delay := t.policy.Backoff(attempt)
+		// 剩余时间不够等待时直接返回, 不占用调用方的超时
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return resp, err
+		}
+		if hook := retryHook(ctx); hook != nil && !hook() {
+			return resp, err
+		}
+		apiRetriesTotal.WithLabelValues(api, code).Inc()
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C:
+		}
+	}
+}
+
+// 执行一次请求并读出完整响应, 返回云API的错误码
+func (t *retryTransport) roundTripOnce(req *http.Request) (*http.Response, string, error) {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if t.reqTimeout > 0 {
+		ctx, cancel = context.WithTimeout(req.Context(), t.reqTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(req.Context())
+	}
+	defer cancel()
+
+	attemptReq := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, "", err
+		}
+		attemptReq.Body = body
+	}
+	resp, err := t.next.RoundTrip(attemptReq)
+	if err != nil {
+		// 调用方取消或超时不重试, 单次请求超时可以重试
+		if req.Context().Err() != nil {
+			return nil, codeCanceled, err
+		}
+		return nil, codeNetworkError, err
+	}
+	content, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		if req.Context().Err() != nil {
+			return nil, codeCanceled, err
+		}
+		return nil, codeNetworkError, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(content))
+	return resp, responseCode(resp, content), nil
+}
+
+// 云API的错误在200响应的body中: {"Response":{"Error":{"Code":"..."}}}
+func responseCode(resp *http.Response, content []byte) string {
+	if resp.StatusCode >= 500 {
+		return fmt.Sprintf("HTTP%d", resp.StatusCode)
+	}
+	var body struct {
+		Response struct {
+			Error *struct {
+				Code string
+			}
+		}
+	}
+	if err := json.Unmarshal(content, &body); err != nil || body.Response.Error == nil {
+		if resp.StatusCode >= 400 {
+			return fmt.Sprintf("HTTP%d", resp.StatusCode)
+		}
+		return codeOK
+	}
+	return body.Response.Error.Code
+}
+
+// sdk请求通过X-TC-Action头传递接口名, cos等其他请求使用http方法
+func apiName(req *http.Request) string {
+	if action := req.Header.Get("X-TC-Action"); action != "" {
+		return action
+	}
+	return req.Method
+}
+
+func newRetryTransport(next http.RoundTripper, policy RetryPolicy, reqTimeout time.Duration) http.RoundTripper {
+	return &retryTransport{
+		next:       next,
+		policy:     policy,
+		reqTimeout: reqTimeout,
+	}
+}
@@ -0,0 +1,170 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 按顺序返回预设的响应, 用完后重复最后一个
+type stubRoundTripper struct {
+	responses []func() (*http.Response, error)
+	calls     int
+}
+
+func (s *stubRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	i := s.calls
+	if i >= len(s.responses) {
+		i = len(s.responses) - 1
+	}
+	s.calls++
+	return s.responses[i]()
+}
+
+func stubResponse(status int, body string) func() (*http.Response, error) {
+	return func() (*http.Response, error) {
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body))}, nil
+	}
+}
+
+func stubErrorCode(code string) func() (*http.Response, error) {
+	return stubResponse(http.StatusOK, fmt.Sprintf(`{"Response":{"Error":{"Code":"%s","Message":"error"},"RequestId":"1"}}`, code))
+}
+
+func stubNetworkError() (*http.Response, error) {
+	return nil, errors.New("connection reset by peer")
+}
+
+var testRetryPolicy = RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+
+func newTestRetryRequest(t *testing.T, ctx context.Context) *http.Request {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://cvm.tencentcloudapi.com/", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-TC-Action", "DescribeInstances")
+	return req
+}
+
+func Test_IsRetryableCode(t *testing.T) {
+	cases := []struct {
+		code string
+		want bool
+	}{
+		{"NetworkError", true},
+		{"RequestLimitExceeded", true},
+		{"RequestLimitExceeded.UinLimitExceeded", true},
+		{"InternalError", true},
+		{"InternalError.DBError", true},
+		{"HTTP500", true},
+		{"HTTP503", true},
+		{"HTTP404", false},
+		{"OK", false},
+		{"Canceled", false},
+		{"InvalidParameter", false},
+		{"AuthFailure.SignatureFailure", false},
+		{"LimitExceeded", false},
+		{"ResourceNotFound", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, IsRetryableCode(c.code), c.code)
+	}
+}
+
+func Test_RetryTransport(t *testing.T) {
+	cases := []struct {
+		name      string
+		responses []func() (*http.Response, error)
+		wantCalls int
+		wantErr   bool
+		wantCode  int
+	}{
+		{"ok", []func() (*http.Response, error){stubResponse(200, `{"Response":{"RequestId":"1"}}`)}, 1, false, 200},
+		{"network error", []func() (*http.Response, error){stubNetworkError}, 4, true, 0},
+		{"request limit", []func() (*http.Response, error){stubErrorCode("RequestLimitExceeded")}, 4, false, 200},
+		{"request limit sub code", []func() (*http.Response, error){stubErrorCode("RequestLimitExceeded.UinLimitExceeded")}, 4, false, 200},
+		{"internal error", []func() (*http.Response, error){stubErrorCode("InternalError.DBError")}, 4, false, 200},
+		{"http 502", []func() (*http.Response, error){stubResponse(502, "bad gateway")}, 4, false, 502},
+		{"http 404", []func() (*http.Response, error){stubResponse(404, "not found")}, 1, false, 404},
+		{"invalid parameter", []func() (*http.Response, error){stubErrorCode("InvalidParameter")}, 1, false, 200},
+		{"recover", []func() (*http.Response, error){
+			stubNetworkError,
+			stubErrorCode("InternalError"),
+			stubResponse(200, `{"Response":{"RequestId":"1"}}`),
+		}, 3, false, 200},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stub := &stubRoundTripper{responses: c.responses}
+			transport := newRetryTransport(stub, testRetryPolicy, 0)
+			resp, err := transport.RoundTrip(newTestRetryRequest(t, context.Background()))
+			assert.Equal(t, c.wantCalls, stub.calls)
+			if c.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.wantCode, resp.StatusCode)
+			// 重试后返回的body可以完整读取
+			_, err = io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_RetryTransportAttempts(t *testing.T) {
+	// 不重试
+	stub := &stubRoundTripper{responses: []func() (*http.Response, error){stubNetworkError}}
+	_, err := newRetryTransport(stub, RetryPolicy{}, 0).RoundTrip(newTestRetryRequest(t, context.Background()))
+	assert.Error(t, err)
+	assert.Equal(t, 1, stub.calls)
+
+	// 剩余时间不够等待时不再重试
+	stub = &stubRoundTripper{responses: []func() (*http.Response, error){stubErrorCode("RequestLimitExceeded")}}
+	policy := RetryPolicy{MaxRetries: 3, BaseDelay: time.Second, MaxDelay: time.Second}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = newRetryTransport(stub, policy, 0).RoundTrip(newTestRetryRequest(t, ctx))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stub.calls)
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+
+	// 调用方取消后不重试
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	stub = &stubRoundTripper{responses: []func() (*http.Response, error){stubNetworkError}}
+	_, err = newRetryTransport(stub, testRetryPolicy, 0).RoundTrip(newTestRetryRequest(t, ctx))
+	assert.Error(t, err)
+	assert.Equal(t, 1, stub.calls)
+}
+
+func Test_RetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	cases := []struct {
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{1, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond, 800 * time.Millisecond},
+		// 超过MaxDelay
+		{4, 500 * time.Millisecond, time.Second},
+		// 移位溢出
+		{70, 500 * time.Millisecond, time.Second},
+	}
+	for _, c := range cases {
+		for i := 0; i < 100; i++ {
+			delay := policy.Backoff(c.attempt)
+			assert.True(t, delay >= c.min && delay < c.max, "attempt=%d delay=%s", c.attempt, delay)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package collector
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 
+	"tencentcloud-exporter/pkg/client"
 	"tencentcloud-exporter/pkg/common"
 	"tencentcloud-exporter/pkg/config"
 	"tencentcloud-exporter/pkg/metric"
@@ -30,6 +32,44 @@ var (
 		[]string{"collector"},
 		nil,
 	)
+	querySuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(exporterNamespace, "query", "success"),
+		"qcloud_exporter: Whether the last query of a metric succeeded.",
+		[]string{"namespace", "metric"},
+		nil,
+	)
+	querySeriesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(exporterNamespace, "query", "series"),
+		"qcloud_exporter: Number of series queried in the last query of a metric.",
+		[]string{"namespace", "metric"},
+		nil,
+	)
+	querySamplesReturnedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(exporterNamespace, "query", "samples_returned"),
+		"qcloud_exporter: Number of datapoints returned in the last query of a metric.",
+		[]string{"namespace", "metric"},
+		nil,
+	)
+	queryEmptySeriesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(exporterNamespace, "query", "empty_series"),
+		"qcloud_exporter: Number of series without any datapoint in the last query of a metric.",
+		[]string{"namespace", "metric"},
+		nil,
+	)
+	seriesNodataDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(exporterNamespace, "series", "nodata"),
+		"qcloud_exporter: Number of series of a metric without any datapoint in consecutive queries.",
+		[]string{"namespace", "metric"},
+		nil,
+	)
+	instanceChangesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: exporterNamespace,
+			Name:      "instance_changes_total",
+			Help:      "qcloud_exporter: Number of instances added to or removed from the instance cache.",
+		},
+		[]string{"namespace", "change"},
+	)
 )
 
 const (
@@ -44,6 +84,10 @@ var (
 type TcMonitorCollector struct {
 	Collectors map[string]*TcProductCollector
 	Reloaders  map[string]*TcProductCollectorReloader
+	Budget     *metric.TcmBudget
+	metricRepo metric.TcmMetricRepository
+	cancel     context.CancelFunc // 停止所有reloader和变更监听
+	wg         *sync.WaitGroup    // 所有后台任务, cancel后等待退出
 	config     *config.TencentConfig
 	logger     log.Logger
 	lock       sync.Mutex
@@ -52,26 +96,76 @@ type TcMonitorCollector struct {
 func (n *TcMonitorCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- scrapeDurationDesc
 	ch <- scrapeSuccessDesc
+	ch <- querySuccessDesc
+	ch <- querySeriesDesc
+	ch <- querySamplesReturnedDesc
+	ch <- queryEmptySeriesDesc
+	ch <- seriesNodataDesc
+	instanceChangesTotal.Describe(ch)
+	client.Describe(ch)
+	n.Budget.Describe(ch)
 }
 
 func (n *TcMonitorCollector) Collect(ch chan<- prometheus.Metric) {
+	n.CollectWithContext(context.Background(), ch)
+}
+
+// ctx一般来自抓取请求, 超时后各产品返回已经采集到的指标
+func (n *TcMonitorCollector) CollectWithContext(ctx context.Context, ch chan<- prometheus.Metric) {
 	wg := sync.WaitGroup{}
 	wg.Add(len(n.Collectors))
 	for name, c := range n.Collectors {
 		go func(name string, c *TcProductCollector) {
 			defer wg.Done()
-			collect(name, c, ch, n.logger)
+			collect(ctx, name, c, ch, n.logger)
 		}(name, c)
 	}
 	wg.Wait()
+	instanceChangesTotal.Collect(ch)
+	client.Collect(ch)
+	n.Budget.Collect(ch)
+}
+
+// 所有产品当前采集的指标目录, 按namespace和指标名排序
+func (n *TcMonitorCollector) Catalog() []*metric.TcmMetricCatalogItem {
+	items := []*metric.TcmMetricCatalogItem{}
+	for _, c := range n.Collectors {
+		items = append(items, c.Catalog()...)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Namespace != items[j].Namespace {
+			return items[i].Namespace < items[j].Namespace
+		}
+		return items[i].MetricName < items[j].MetricName
+	})
+	return items
+}
+
+// 绑定单次抓取请求的ctx, 每次请求注册到单独的registry
+func (n *TcMonitorCollector) WithContext(ctx context.Context) prometheus.Collector {
+	return &scrapeCollector{ctx: ctx, collector: n}
+}
+
+type scrapeCollector struct {
+	ctx       context.Context
+	collector *TcMonitorCollector
+}
+
+func (s *scrapeCollector) Describe(ch chan<- *prometheus.Desc) {
+	s.collector.Describe(ch)
+}
+
+func (s *scrapeCollector) Collect(ch chan<- prometheus.Metric) {
+	s.collector.CollectWithContext(s.ctx, ch)
 }
 
-func collect(name string, c *TcProductCollector, ch chan<- prometheus.Metric, logger log.Logger) {
+func collect(ctx context.Context, name string, c *TcProductCollector, ch chan<- prometheus.Metric, logger log.Logger) {
 	begin := time.Now()
 	level.Info(logger).Log("msg", "Start collect......", "name", name)
 
-	err := c.Collect(ch)
+	err := c.Collect(ctx, ch)
 	duration := time.Since(begin)
+	c.recordCollect(begin, duration, err)
 	var success float64
 
 	if err != nil {
@@ -85,16 +179,91 @@ func collect(name string, c *TcProductCollector, ch chan<- prometheus.Metric, lo
 	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
 }
 
-func NewTcMonitorCollector(cred common.CredentialIface, conf *config.TencentConfig, logger log.Logger) (*TcMonitorCollector, error) {
+// 停止后台任务, 配置了state_dir时将缓存写入快照
+// 等待后台任务退出后再写入, 避免快照与正在进行的刷新交错
+func (n *TcMonitorCollector) Close() error {
+	n.cancel()
+	n.wg.Wait()
+
+	var err error
+	flushers := []snapshotFlusher{}
+	if f, ok := n.metricRepo.(snapshotFlusher); ok {
+		flushers = append(flushers, f)
+	}
+	for _, c := range n.Collectors {
+		if f, ok := c.InstanceRepo.(snapshotFlusher); ok {
+			flushers = append(flushers, f)
+		}
+	}
+	for _, f := range flushers {
+		if e := f.Flush(); e != nil {
+			level.Error(n.logger).Log("msg", "Flush cache fail", "err", e)
+			err = e
+		}
+	}
+	return err
+}
+
+// 使用metric_name_template时, 不同产品的指标不能重名
+func checkMetricNameCollisions(collectors map[string]*TcProductCollector) error {
+	owners := map[string]string{}
+	for namespace, c := range collectors {
+		c.lock.RLock()
+		for _, m := range c.MetricMap {
+			if m.Conf.NameTemplate == "" {
+				continue
+			}
+			for _, desc := range m.StatPromDesc {
+				owner := namespace + "." + m.Meta.MetricName
+				if other, ok := owners[desc.FQName]; ok && other != owner {
+					c.lock.RUnlock()
+					return fmt.Errorf("metric name %s collides between %s and %s", desc.FQName, other, owner)
+				}
+				owners[desc.FQName] = owner
+			}
+		}
+		c.lock.RUnlock()
+	}
+	return nil
+}
+
+// 支持将缓存写入state_dir快照的repository
+type snapshotFlusher interface {
+	Flush() error
+}
+
+// 按元数据有效期定时刷新的repository
+type metaRefresher interface {
+	RefreshMetaPeriodically(ctx context.Context, namespace string)
+}
+
+func NewTcMonitorCollector(
+	ctx context.Context,
+	cred common.CredentialIface,
+	conf *config.TencentConfig,
+	logger log.Logger,
+) (*TcMonitorCollector, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	wg := &sync.WaitGroup{}
+	goBackground := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f()
+		}()
+	}
 	collectors := make(map[string]*TcProductCollector)
 	reloaders := make(map[string]*TcProductCollectorReloader)
 
-	metricRepo, err := metric.NewTcmMetricRepository(cred, conf, logger)
+	budget := metric.NewTcmBudget(conf, logger)
+	metricRepo, err := metric.NewTcmMetricRepository(cred, conf, budget, logger)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 	// 使用meta缓存
-	metricRepoCache := metric.NewTcmMetricCache(metricRepo, logger)
+	metricRepoCache := metric.NewTcmMetricCache(metricRepo,
+		time.Duration(conf.MetaReloadMinutes)*time.Minute, conf.StateDir, logger)
 
 	for _, namespace := range conf.GetNamespaces() {
 		state, exists := collectorState[namespace]
@@ -104,6 +273,7 @@ func NewTcMonitorCollector(cred common.CredentialIface, conf *config.TencentConf
 
 		pconf, err := conf.GetProductConfig(namespace)
 		if err != nil {
+			cancel()
 			return nil, err
 		}
 
@@ -115,11 +285,18 @@ func NewTcMonitorCollector(cred common.CredentialIface, conf *config.TencentConf
 		collectorState[namespace] = 1
 		level.Info(logger).Log("msg", "Create product collecter ok", "Namespace", namespace)
 
+		goBackground(func() { collector.WatchChanges(ctx) })
+		if r, ok := metricRepoCache.(metaRefresher); ok {
+			ns := namespace
+			goBackground(func() { r.RefreshMetaPeriodically(ctx, ns) })
+		}
+		goBackground(func() { collector.refreshRestoredInstances(ctx) })
+
 		if pconf.IsReloadEnable() {
 			reloadInterval := time.Duration(pconf.ReloadIntervalMinutes * int64(time.Minute))
-			reloader := NewTcProductCollectorReloader(context.TODO(), collector, reloadInterval, logger)
+			reloader := NewTcProductCollectorReloader(ctx, collector, reloadInterval, logger)
 			reloaders[namespace] = reloader
-			go reloader.Run()
+			goBackground(reloader.Run)
 			level.Info(logger).Log(
 				"msg", fmt.Sprintf("reload %s instances every %d minutes",
 					namespace, pconf.ReloadIntervalMinutes),
@@ -127,10 +304,20 @@ func NewTcMonitorCollector(cred common.CredentialIface, conf *config.TencentConf
 		}
 	}
 
+	if err := checkMetricNameCollisions(collectors); err != nil {
+		cancel()
+		wg.Wait()
+		return nil, err
+	}
+
 	level.Info(logger).Log("msg", "Create all product collecter ok", "num", len(collectors))
 	return &TcMonitorCollector{
 		Collectors: collectors,
 		Reloaders:  reloaders,
+		Budget:     budget,
+		metricRepo: metricRepoCache,
+		cancel:     cancel,
+		wg:         wg,
 		config:     conf,
 		logger:     logger,
 	}, nil
@@ -0,0 +1,284 @@
+package collector
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+
+	"tencentcloud-exporter/pkg/common"
+	"tencentcloud-exporter/pkg/config"
+	"tencentcloud-exporter/pkg/fakecloud"
+	"tencentcloud-exporter/pkg/metric"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata/golden")
+
+type goldenMetric struct {
+	name       string
+	dimensions []string
+}
+
+// 每个产品一个case, 实例列表等云API响应在testdata/golden/<name>/<service>/<Action>.json,
+// 采集结果与testdata/golden/<name>.prom对比
+var goldenCases = []struct {
+	name      string
+	namespace string
+	product   string // 配置中的产品名, 为空时与namespace相同
+	metrics   []goldenMetric
+}{
+	{"cbs", CbsNamespace, "QCE/CBS", []goldenMetric{
+		{"DiskReadTraffic", []string{"diskId"}},
+		{"DiskUsage", []string{"unInstanceId"}},
+	}},
+	{"cdb", CdbNamespace, "", []goldenMetric{
+		{"Qps", []string{"InstanceId"}},
+	}},
+	{"cdn", CdnNamespace, "", []goldenMetric{
+		{"Requests", []string{"domain", "projectId"}},
+	}},
+	{"cfs", CfsNamespace, "", []goldenMetric{
+		{"DataReadIoBytes", []string{"FileSystemId"}},
+		{"SnapshotTotalSize", []string{"appid"}},
+	}},
+	{"clb", ClbNamespace, "", []goldenMetric{
+		{"ClientConnum", []string{"vip"}},
+	}},
+	{"clb7", Clb7Namespace, "", []goldenMetric{
+		{"Connum", []string{"vip"}},
+	}},
+	{"clb_private", ClbPrivateNamespace, "", []goldenMetric{
+		{"ClientConnum", []string{"vip", "vpcId"}},
+	}},
+	{"cmq", CMQNamespace, "", []goldenMetric{
+		{"MsgCount", []string{"queueId", "queueName"}},
+	}},
+	{"cmqtopic", CMQTopicNamespace, "", []goldenMetric{
+		{"MsgCount", []string{"topicId"}},
+	}},
+	{"cos", CosNamespace, "", []goldenMetric{
+		{"StdStorage", []string{"bucket"}},
+	}},
+	{"cvm", CvmNamespace, "", []goldenMetric{
+		{"CpuUsage", []string{"InstanceId"}},
+	}},
+	{"cynosdb", CynosdbNamespace, "", []goldenMetric{
+		{"Cpuuserate", []string{"InstanceId"}},
+		{"Storageusage", []string{"ClusterId", "InstanceId"}},
+	}},
+	{"dc", DcNamespace, "", []goldenMetric{
+		{"Outbandwidth", []string{"directConnectId"}},
+	}},
+	{"dcdb", DcdbNamespace, "", []goldenMetric{
+		{"ActiveThreadCount", []string{"InstanceId"}},
+	}},
+	{"dcg", DcgNamespace, "", []goldenMetric{
+		{"Inbandwidth", []string{"directConnectGatewayId"}},
+	}},
+	{"dcx", DcxNamespace, "", []goldenMetric{
+		{"Delay", []string{"directConnectConnId"}},
+	}},
+	{"dts", DTSNamespace, "", []goldenMetric{
+		{"SubscribeLag", []string{"SubscribeId", "subscribe_name"}},
+		{"SyncLag", []string{"replicationjobid", "replicationjob_name"}},
+		{"MigrateLag", []string{"migratejobid", "migratejob_name"}},
+	}},
+	{"eip", EIPNamespace, "", []goldenMetric{
+		{"VipOutTraffic", []string{"eip"}},
+	}},
+	{"es", ESNamespace, "", []goldenMetric{
+		{"Status", []string{"uInstanceId"}},
+	}},
+	{"kafka", KafkaNamespace, "", []goldenMetric{
+		{"InstanceProCount", []string{"instanceId"}},
+	}},
+	{"lighthouse", LighthouseNamespace, "", []goldenMetric{
+		{"CpuUsage", []string{"InstanceId"}},
+	}},
+	{"mariadb", MariaDBNamespace, "", []goldenMetric{
+		{"Qps", []string{"InstanceId"}},
+	}},
+	{"memcached", MemcachedNamespace, "", []goldenMetric{
+		{"Storage", []string{"instanceid"}},
+	}},
+	{"mongo", MongoNamespace, "", []goldenMetric{
+		{"Inserts", []string{"target"}},
+		{"SlaveDelay", []string{"target"}},
+		{"CpuUsage", []string{"target"}},
+	}},
+	{"nacos", NacosNamespace, "", []goldenMetric{
+		{"PodCpuUsage", []string{"NacosInstanceId", "PodName"}},
+		{"InterfaceRequests", []string{"NacosInstanceId", "PodName", "Interface"}},
+	}},
+	{"nat", NatNamespace, "", []goldenMetric{
+		{"Outbandwidth", []string{"natId"}},
+	}},
+	{"pg", PGNamespace, "", []goldenMetric{
+		{"Cpu", []string{"resourceId"}},
+	}},
+	{"qaap", QaapNamespace, "", []goldenMetric{
+		{"InFlow", []string{"channelId"}},
+		{"GroupInFlow", []string{"GroupId"}},
+		{"IpConnum", []string{"ip", "proxyid", "groupid", "isp"}},
+		{"ListenerConnum", []string{"instanceid", "listenerid", "protocol"}},
+		{"ListenerRsStatus", []string{"channelId", "listenerId", "originServerInfo", "protocol", "listenerName"}},
+		{"RuleRsStatus", []string{"instanceid", "listenerid", "ruleid", "rs_ip"}},
+	}},
+	{"redis", RedisNamespace, "QCE/CLUSTER_REDIS", []goldenMetric{
+		{"CpuUsMin", []string{"instanceid"}},
+	}},
+	{"redis_mem", RedisMemNamespace, "", []goldenMetric{
+		{"CpuUtil", []string{"instanceid"}},
+		{"CpuUtilProxy", []string{"instanceid", "pnodeid"}},
+		{"CpuUtilNode", []string{"instanceid", "rnodeid"}},
+	}},
+	{"rocketmq", RocketMQNamespace, "", []goldenMetric{
+		{"TpsIn", []string{"tenant"}},
+		{"TopicMsgIn", []string{"tenant", "namespace", "topic"}},
+		{"GroupMsgOut", []string{"tenant", "namespace", "group"}},
+		{"ConsumerLag", []string{"tenant", "namespace", "topic", "group"}},
+	}},
+	{"sqlserver", SqlServerNamespace, "", []goldenMetric{
+		{"Cpu", []string{"resourceId"}},
+	}},
+	{"vbc", VbcNamespace, "", []goldenMetric{
+		{"Regioninbandwidthbm", []string{"CcnId", "SRegion"}},
+		{"Outbandwidth", []string{"CcnId", "SRegion", "DRegion"}},
+	}},
+	{"vpngw", VpngwNamespace, "", []goldenMetric{
+		{"Outbandwidth", []string{"vpnGwId"}},
+	}},
+	{"vpnx", VpnxNamespace, "", []goldenMetric{
+		{"Outbandwidth", []string{"vpnConnId"}},
+	}},
+	{"waf", WafNamespace, "", []goldenMetric{
+		{"Access", []string{"domain", "edition"}},
+		{"Attack", []string{"edition"}},
+	}},
+	{"zookeeper", ZookeeperNamespace, "", []goldenMetric{
+		{"PodCpuUsage", []string{"InstanceId", "PodName"}},
+		{"InterfaceRequests", []string{"InstanceId", "PodName", "Interface"}},
+	}},
+}
+
+// 数据点只与纬度有关, 不随查询时间变化
+func goldenValue(dimensions map[string]string, timestamp int64) (float64, bool) {
+	var kvs []string
+	for k, v := range dimensions {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	h := fnv.New32a()
+	h.Write([]byte(strings.Join(kvs, ",")))
+	return float64(h.Sum32()%10000) / 100, true
+}
+
+func loadGoldenConfig(t *testing.T, s *fakecloud.Server, product string) *config.TencentConfig {
+	content := fmt.Sprintf(`credential:
+  access_key: %s
+  secret_key: %s
+  region: ap-guangzhou
+client:
+  endpoint: %s
+products:
+  - namespace: %s
+    all_metrics: true
+    all_instances: true
+`, s.SecretId, s.SecretKey, s.URL(), product)
+	filename := filepath.Join(t.TempDir(), "qcloud.yml")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := config.NewConfig()
+	if err := conf.LoadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	return conf
+}
+
+func TestHandlersGolden(t *testing.T) {
+	tested := map[string]bool{}
+	for _, tc := range goldenCases {
+		tc := tc
+		tested[tc.namespace] = true
+		t.Run(tc.name, func(t *testing.T) {
+			s := fakecloud.NewServer("AKIDgolden", "golden")
+			defer s.Close()
+			if err := s.LoadFixtures(filepath.Join("testdata", "golden", tc.name)); err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range tc.metrics {
+				s.AddMetric(fakecloud.NewMetricSet(tc.namespace, m.name, "count", "max", []int64{60, 300}, m.dimensions))
+				s.SetMetricValues(tc.namespace, m.name, goldenValue)
+			}
+
+			product := tc.product
+			if product == "" {
+				product = tc.namespace
+			}
+			conf := loadGoldenConfig(t, s, product)
+			pconf, err := conf.GetProductConfig(tc.namespace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			logger := log.NewNopLogger()
+			cred := &common.Credential{SecretId: s.SecretId, SecretKey: s.SecretKey}
+			repo, err := metric.NewTcmMetricRepository(cred, conf, metric.NewTcmBudget(conf, logger), logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := NewTcProductCollector(tc.namespace, repo, cred, conf, &pconf, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := prometheus.NewPedanticRegistry()
+			r.MustRegister(&lintCollector{product: c})
+			mfs, err := r.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(mfs) == 0 {
+				t.Fatal("no metrics collected")
+			}
+			var buf bytes.Buffer
+			for _, mf := range mfs {
+				if _, err := expfmt.MetricFamilyToText(&buf, mf); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			golden := filepath.Join("testdata", "golden", tc.name+".prom")
+			if *updateGolden {
+				if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(expected, buf.Bytes()) {
+				t.Errorf("exposition differs from %s, run with -update if the change is expected\n--- expected\n%s\n--- actual\n%s",
+					golden, expected, buf.Bytes())
+			}
+		})
+	}
+
+	// 新注册的handler也需要添加case
+	for namespace := range handlerFactoryMap {
+		if !tested[namespace] {
+			t.Errorf("no golden case for %s", namespace)
+		}
+	}
+}
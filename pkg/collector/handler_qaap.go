@@ -196,14 +196,15 @@ func (h *QaapHandler) getQaapListenerRsSeries(m *metric.TcmMetric, ins instance.
 	go func() {
 		defer wg.Done()
 		tcpSeries, _ = h.getTcpSeries(m, ins)
-		series = append(series, tcpSeries...)
 	}()
 	go func() {
 		defer wg.Done()
 		udpSeries, _ = h.getUdpSeries(m, ins)
-		series = append(series, udpSeries...)
 	}()
 	wg.Wait()
+	// 两个goroutine同时append会丢失series, 等待完成后再合并
+	series = append(series, tcpSeries...)
+	series = append(series, udpSeries...)
 
 	// tcpListenersInfos, err := h.qaapInstanceInfoRepo.GetTCPListenersInfo(ins.GetInstanceId())
 	// if err != nil {
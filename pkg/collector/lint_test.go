@@ -0,0 +1,289 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	monitor "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/monitor/v20180724"
+
+	"tencentcloud-exporter/pkg/common"
+	"tencentcloud-exporter/pkg/config"
+	"tencentcloud-exporter/pkg/instance"
+	"tencentcloud-exporter/pkg/metric"
+)
+
+const lintMetricName = "LintMetric"
+
+var lintDimensions = []string{"InstanceId", "vip", "vport"}
+
+// 只支持特定指标名或单个纬度的产品
+var lintMetaOverrides = map[string]struct {
+	metricName string
+	dimensions []string
+}{
+	KafkaNamespace: {lintMetricName, []string{KafkaInstanceIDKey}},
+	DcdbNamespace:  {lintMetricName, []string{DcdbInstanceidKey}},
+	EIPNamespace:   {lintMetricName, []string{EIPInstanceidKey}},
+	RedisNamespace: {"CpuUsMin", []string{RedisInstanceidKey}},
+}
+
+// 不访问云API的实例, 只有部分时间线带实例字段
+type lintInstance struct {
+	id     string
+	fields map[string]string
+}
+
+func (ins *lintInstance) GetInstanceId() string      { return ins.id }
+func (ins *lintInstance) GetMonitorQueryKey() string { return ins.id }
+func (ins *lintInstance) GetMeta() interface{}       { return ins.fields }
+
+func (ins *lintInstance) GetFieldValueByName(name string) (string, error) {
+	v, ok := ins.fields[name]
+	if !ok {
+		return "", fmt.Errorf("field %s not found", name)
+	}
+	return v, nil
+}
+
+func (ins *lintInstance) GetFieldValuesByName(name string) (map[string][]string, error) {
+	v, ok := ins.fields[name]
+	if !ok {
+		return nil, fmt.Errorf("field %s not found", name)
+	}
+	return map[string][]string{name: {v}}, nil
+}
+
+// 返回固定元数据和数据点的指标Repository
+type lintMetricRepository struct {
+	meta *metric.TcmMeta
+}
+
+func (repo *lintMetricRepository) GetMeta(namespace string, name string) (*metric.TcmMeta, error) {
+	return repo.meta, nil
+}
+
+func (repo *lintMetricRepository) ListMetaByNamespace(namespace string) ([]*metric.TcmMeta, error) {
+	return []*metric.TcmMeta{repo.meta}, nil
+}
+
+func (repo *lintMetricRepository) GetSamples(ctx context.Context, s *metric.TcmSeries, st int64, et int64) (*metric.TcmSamples, error) {
+	var dimensions []*monitor.Dimension
+	for k, v := range s.QueryLabels {
+		name, value := k, v
+		dimensions = append(dimensions, &monitor.Dimension{Name: &name, Value: &value})
+	}
+	var samples []*metric.TcmSample
+	for i := int64(0); i < 3; i++ {
+		samples = append(samples, &metric.TcmSample{
+			Timestamp:  float64(et - (2-i)*60),
+			Value:      float64(i + 1),
+			Dimensions: dimensions,
+		})
+	}
+	return &metric.TcmSamples{Series: s, Samples: samples}, nil
+}
+
+func (repo *lintMetricRepository) ListSamples(ctx context.Context, m *metric.TcmMetric, st int64, et int64) ([]*metric.TcmSamples, error) {
+	var samplesList []*metric.TcmSamples
+	for _, s := range m.GetSeriesCache().Series {
+		samples, err := repo.GetSamples(ctx, s, st, et)
+		if err != nil {
+			return nil, err
+		}
+		samplesList = append(samplesList, samples)
+	}
+	return samplesList, nil
+}
+
+func newLintMeta(namespace string) (*metric.TcmMeta, error) {
+	name, names := lintMetricName, lintDimensions
+	if override, ok := lintMetaOverrides[namespace]; ok {
+		name, names = override.metricName, override.dimensions
+	}
+	var dimensions []*string
+	for _, d := range names {
+		dimension := d
+		dimensions = append(dimensions, &dimension)
+	}
+	var periods []*monitor.PeriodsSt
+	for _, p := range []string{"60", "300"} {
+		period, statType := p, "max"
+		periods = append(periods, &monitor.PeriodsSt{Period: &period, StatType: []*string{&statType}})
+	}
+	period60, period300 := int64(60), int64(300)
+	unit, meaning := "%", "lint"
+	return metric.NewTcmMeta(&monitor.MetricSet{
+		Namespace:  &namespace,
+		MetricName: &name,
+		Unit:       &unit,
+		Period:     []*int64{&period60, &period300},
+		Periods:    periods,
+		Meaning:    &monitor.MetricObjectMeaning{En: &meaning, Zh: &meaning},
+		Dimensions: []*monitor.DimensionsDesc{{Dimensions: dimensions}},
+	})
+}
+
+// 配置中使用产品名, 如QCE/BLOCK_STORAGE配置为QCE/CBS
+func lintCustomNamespace(namespace string) string {
+	var products []string
+	for product, ns := range config.Product2Namespace {
+		if ns == namespace {
+			products = append(products, product)
+		}
+	}
+	sort.Strings(products)
+	if len(products) == 0 {
+		return namespace
+	}
+	return strings.Split(namespace, "/")[0] + "/" + strings.ToUpper(products[0])
+}
+
+func loadLintConfig(t *testing.T, namespace string) *config.TencentConfig {
+	content := fmt.Sprintf(`credential:
+  access_key: lint
+  secret_key: lint
+  region: ap-guangzhou
+products:
+  - namespace: %s
+    all_metrics: true
+    all_instances: true
+    extra_labels: [InstanceName]
+    statistics_types: [last, max]
+`, lintCustomNamespace(namespace))
+	filename := filepath.Join(t.TempDir(), "qcloud.yml")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := config.NewConfig()
+	if err := conf.LoadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	return conf
+}
+
+// 将产品采集的指标作为一个Collector, 用于注册到registry
+type lintCollector struct {
+	product *TcProductCollector
+}
+
+func (c *lintCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *lintCollector) Collect(ch chan<- prometheus.Metric) {
+	c.product.Collect(context.Background(), ch)
+}
+
+func newLintProductCollector(t *testing.T, namespace string) *TcProductCollector {
+	conf := loadLintConfig(t, namespace)
+	pconf, err := conf.GetProductConfig(namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := newLintMeta(namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.NewNopLogger()
+	c := &TcProductCollector{
+		Namespace:   namespace,
+		MetricRepo:  &lintMetricRepository{meta: meta},
+		MetricMap:   make(map[string]*metric.TcmMetric),
+		Conf:        conf,
+		ProductConf: &pconf,
+		logger:      logger,
+	}
+	cred := &common.Credential{SecretId: "lint", SecretKey: "lint"}
+	c.handler, err = handlerFactoryMap[namespace](cred, c, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nm, err := c.createMetricWithProductConf(meta.MetricName, pconf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nm == nil {
+		t.Fatalf("%s does not support the lint metric", namespace)
+	}
+	if err := c.addMetric(nm); err != nil {
+		t.Fatal(err)
+	}
+
+	// 时间线的纬度和实例字段各不相同, 导出的标签集合仍需一致
+	var series []*metric.TcmSeries
+	for i, n := range []int{len(nm.Meta.SupportDimensions), 1} {
+		ql := metric.Labels{}
+		for _, d := range nm.Meta.SupportDimensions[:n] {
+			ql[d] = fmt.Sprintf("%s-%d", strings.ToLower(d), i)
+		}
+		var ins instance.TcInstance
+		if i == 0 {
+			ins = &lintInstance{id: "ins-0", fields: map[string]string{"InstanceName": "lint"}}
+		}
+		s, err := metric.NewTcmSeries(nm, ql, ins)
+		if err != nil {
+			t.Fatal(err)
+		}
+		series = append(series, s)
+	}
+	if err := nm.LoadSeries(series); err != nil {
+		t.Fatal(err)
+	}
+	c.initQuerys()
+	return c
+}
+
+func TestHandlersGatherAndLint(t *testing.T) {
+	var namespaces []string
+	for namespace := range handlerFactoryMap {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	for _, namespace := range namespaces {
+		namespace := namespace
+		t.Run(namespace, func(t *testing.T) {
+			r := prometheus.NewPedanticRegistry()
+			r.MustRegister(&lintCollector{product: newLintProductCollector(t, namespace)})
+			mfs, err := r.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(mfs) == 0 {
+				t.Fatal("no metrics collected")
+			}
+			// 同一个指标的所有时间线标签名一致且有序
+			for _, mf := range mfs {
+				var expected []string
+				for i, m := range mf.GetMetric() {
+					var names []string
+					for _, l := range m.GetLabel() {
+						names = append(names, l.GetName())
+					}
+					if !sort.StringsAreSorted(names) {
+						t.Errorf("%s: labels not sorted, %v", mf.GetName(), names)
+					}
+					if i == 0 {
+						expected = names
+					} else if strings.Join(names, ",") != strings.Join(expected, ",") {
+						t.Errorf("%s: inconsistent labels, %v != %v", mf.GetName(), names, expected)
+					}
+				}
+			}
+			problems, err := testutil.GatherAndLint(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range problems {
+				t.Errorf("%s: %s", p.Metric, p.Text)
+			}
+		})
+	}
+}
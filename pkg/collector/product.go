@@ -2,6 +2,7 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -32,6 +33,12 @@ type TcProductCollector struct {
 	handler      ProductHandler
 	logger       log.Logger
 	lock         sync.RWMutex
+
+	// 最近一次采集的状态, 用于/status
+	lastCollectTime     time.Time
+	lastCollectDuration time.Duration
+	lastCollectErr      error
+	statusLock          sync.Mutex
 }
 
 // 指标纬度配置
@@ -47,7 +54,11 @@ func (c *TcProductCollector) LoadMetricsByMetricConf() error {
 				"Namespace", c.Namespace, "name", mconf.MetricName)
 			continue
 		}
-		c.MetricMap[nm.Meta.MetricName] = nm
+		if err := c.addMetric(nm); err != nil {
+			level.Error(c.logger).Log("msg", "Add metric fail", "err", err,
+				"Namespace", c.Namespace, "name", mconf.MetricName)
+			continue
+		}
 
 		series, err := c.handler.GetSeries(nm)
 		if err != nil {
@@ -95,9 +106,11 @@ func (c *TcProductCollector) LoadMetricsByProductConf() error {
 					// maybe some metric not support
 					// continue
 				}
-				c.lock.Lock()
-				c.MetricMap[nm.Meta.MetricName] = nm
-				c.lock.Unlock()
+				if err := c.addMetric(nm); err != nil {
+					level.Error(c.logger).Log("msg", "Add metric fail", "err", err, "Namespace", c.Namespace, "name", mname)
+					group.Done()
+					return
+				}
 				// 获取该指标下的所有实例纬度查询或自定义纬度查询
 				series, err := c.handler.GetSeries(nm)
 				if err != nil {
@@ -124,7 +137,10 @@ func (c *TcProductCollector) LoadMetricsByProductConf() error {
 				// maybe some metric not support
 				continue
 			}
-			c.MetricMap[nm.Meta.MetricName] = nm
+			if err := c.addMetric(nm); err != nil {
+				level.Error(c.logger).Log("msg", "Add metric fail", "err", err, "Namespace", c.Namespace, "name", mname)
+				continue
+			}
 
 			// 获取该指标下的所有实例纬度查询或自定义纬度查询
 			series, err := c.handler.GetSeries(nm)
@@ -143,6 +159,28 @@ func (c *TcProductCollector) LoadMetricsByProductConf() error {
 	return nil
 }
 
+// 使用metric_name_template时, 拒绝与已有指标重名的指标
+func (c *TcProductCollector) addMetric(nm *metric.TcmMetric) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if nm.Conf.NameTemplate != "" {
+		for name, m := range c.MetricMap {
+			if name == nm.Meta.MetricName {
+				continue
+			}
+			for _, desc := range m.StatPromDesc {
+				for _, newDesc := range nm.StatPromDesc {
+					if desc.FQName == newDesc.FQName {
+						return fmt.Errorf("metric name %s collides with %s", newDesc.FQName, m.Meta.MetricName)
+					}
+				}
+			}
+		}
+	}
+	c.MetricMap[nm.Meta.MetricName] = nm
+	return nil
+}
+
 func (c *TcProductCollector) getMetricNames(pconf config.TencentProduct) ([]string, error) {
 	var metricNames []string
 
@@ -201,6 +239,8 @@ func (c *TcProductCollector) createMetricWithProductConf(mname string, pconf con
 		if err != nil {
 			return nil, err
 		}
+		conf.HelpLanguage = c.Conf.HelpLanguage
+		conf.RelabelConfigs = c.relabelConfigs()
 		nm, err := metric.NewTcmMetric(meta, conf)
 		if err != nil {
 			return nil, err
@@ -233,12 +273,16 @@ func (c *TcProductCollector) createMetricWithMetricConf(mconf config.TencentMetr
 		return nil, err
 	}
 
+	c.lock.RLock()
 	m, ok := c.MetricMap[meta.MetricName]
+	c.lock.RUnlock()
 	if !ok {
 		conf, err := metric.NewTcmMetricConfigWithMetricYaml(mconf, meta)
 		if err != nil {
 			return nil, err
 		}
+		conf.HelpLanguage = c.Conf.HelpLanguage
+		conf.RelabelConfigs = c.relabelConfigs()
 		nm, err := metric.NewTcmMetric(meta, conf)
 		if err != nil {
 			return nil, err
@@ -258,45 +302,241 @@ func (c *TcProductCollector) createMetricWithMetricConf(mconf config.TencentMetr
 
 // 一个query管理一个metric的采集
 func (c *TcProductCollector) initQuerys() (err error) {
+	c.syncQuerys()
+	return
+}
+
+// 按MetricMap同步Querys, 保留已有的query, 删除指标已不存在的query
+func (c *TcProductCollector) syncQuerys() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	existing := map[*metric.TcmMetric]*metric.TcmQuery{}
+	for _, q := range c.Querys {
+		existing[q.Metric] = q
+	}
+	var querys metric.TcmQuerySet
 	var numSeries int
 	for _, m := range c.MetricMap {
-		q, e := metric.NewTcmQuery(m, c.MetricRepo)
-		if e != nil {
-			return e
+		q, ok := existing[m]
+		if !ok {
+			q, _ = metric.NewTcmQuery(m, c.MetricRepo)
 		}
-		c.Querys = append(c.Querys, q)
-		numSeries += len(q.Metric.SeriesCache.Series)
+		querys = append(querys, q)
+		numSeries += len(q.Metric.GetSeriesCache().Series)
 	}
-	level.Info(c.logger).Log("msg", "Init all query ok", "Namespace", c.Namespace, "numMetric", len(c.Querys), "numSeries", numSeries)
-	return
+	level.Info(c.logger).Log("msg", "Sync all query ok", "Namespace", c.Namespace,
+		"numMetric", len(querys), "numDropped", len(c.Querys)-len(querys), "numSeries", numSeries)
+	c.Querys = querys
 }
 
 // 执行所有指标的采集
-func (c *TcProductCollector) Collect(ch chan<- prometheus.Metric) (err error) {
-	wg := sync.WaitGroup{}
-	wg.Add(len(c.Querys))
-	for _, query := range c.Querys {
+// ctx结束时返回已经查询到的指标, 未完成的查询随ctx取消
+func (c *TcProductCollector) Collect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.lock.RLock()
+	querys := c.Querys
+	c.lock.RUnlock()
+
+	if c.ProductConf.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(c.ProductConf.TimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+
+	type queryResult struct {
+		query *metric.TcmQuery
+		pms   []prometheus.Metric
+		err   error
+	}
+	// 带缓冲, 超时返回后仍在执行的查询不会阻塞, 也不会写入已经关闭的ch
+	results := make(chan *queryResult, len(querys))
+	for _, query := range querys {
 		go func(q *metric.TcmQuery) {
-			defer wg.Done()
-			pms, err0 := q.GetPromMetrics()
-			if err0 != nil {
+			pms, err := q.GetPromMetrics(ctx)
+			results <- &queryResult{query: q, pms: pms, err: err}
+		}(query)
+	}
+
+	var errs []error
+	done := map[*metric.TcmQuery]bool{}
+	for i := 0; i < len(querys); i++ {
+		select {
+		case <-ctx.Done():
+			level.Warn(c.logger).Log("msg", "Collect timeout, return partial results",
+				"namespace", c.Namespace, "done", i, "total", len(querys))
+			// 未完成的查询视为失败
+			for _, q := range querys {
+				if !done[q] {
+					c.collectQueryMetrics(ch, q, false)
+				}
+			}
+			return errors.Join(append(errs, ctx.Err())...)
+		case r := <-results:
+			done[r.query] = true
+			c.collectQueryMetrics(ch, r.query, r.err == nil)
+			if r.err != nil {
 				level.Error(c.logger).Log(
 					"msg", "Get samples fail",
-					"err", err,
-					"metric", q.Metric.Id,
+					"err", r.err,
+					"metric", r.query.Metric.Id,
 				)
-				err = err0
-			} else {
-				for _, pm := range pms {
-					ch <- pm
-				}
+				errs = append(errs, fmt.Errorf("%s: %w", r.query.Metric.Meta.MetricName, r.err))
 			}
+			// 部分批次失败时仍导出已查询到的指标
+			for _, pm := range r.pms {
+				ch <- pm
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
 
-		}(query)
+// 每个指标最近一次查询的结果, 用于对单个指标不再返回数据告警
+func (c *TcProductCollector) collectQueryMetrics(ch chan<- prometheus.Metric, q *metric.TcmQuery, success bool) {
+	name := q.Metric.Meta.MetricName
+	var v float64
+	if success {
+		v = 1
 	}
-	wg.Wait()
+	ch <- prometheus.MustNewConstMetric(querySuccessDesc, prometheus.GaugeValue, v, c.Namespace, name)
+	stats := q.LatestStats()
+	if stats == nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(querySeriesDesc, prometheus.GaugeValue, float64(stats.Series), c.Namespace, name)
+	ch <- prometheus.MustNewConstMetric(querySamplesReturnedDesc, prometheus.GaugeValue, float64(stats.SamplesReturned), c.Namespace, name)
+	ch <- prometheus.MustNewConstMetric(queryEmptySeriesDesc, prometheus.GaugeValue, float64(stats.EmptySeries), c.Namespace, name)
+	ch <- prometheus.MustNewConstMetric(seriesNodataDesc, prometheus.GaugeValue, float64(len(q.Metric.GetNodataSeries())), c.Namespace, name)
+}
 
-	return
+// 先执行产品的relabel规则, 再执行全局的
+func (c *TcProductCollector) relabelConfigs() []*config.RelabelConfig {
+	var rules []*config.RelabelConfig
+	rules = append(rules, c.ProductConf.MetricRelabelConfigs...)
+	rules = append(rules, c.Conf.MetricRelabelConfigs...)
+	return rules
+}
+
+// 该产品当前采集的所有指标的目录
+func (c *TcProductCollector) Catalog() []*metric.TcmMetricCatalogItem {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	var items []*metric.TcmMetricCatalogItem
+	for _, m := range c.MetricMap {
+		items = append(items, m.GetCatalogItem())
+	}
+	return items
+}
+
+// 监听实例和指标元数据的变更事件, 立即更新受影响的指标, 不必等到下次product reload
+func (c *TcProductCollector) WatchChanges(ctx context.Context) {
+	// 不支持的变更类型保持nil channel, select时永远阻塞
+	var instanceChanges <-chan *instance.TcInstanceChange
+	if notifier, ok := c.InstanceRepo.(instance.TcInstanceChangeNotifier); ok {
+		instanceChanges = notifier.Changes()
+	}
+	var metaChanges <-chan *metric.TcmMetaChange
+	if notifier, ok := c.MetricRepo.(metric.TcmMetaChangeNotifier); ok {
+		metaChanges = notifier.MetaChanges(c.Namespace)
+	}
+	if instanceChanges == nil && metaChanges == nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change := <-instanceChanges:
+			c.onInstanceChange(change)
+		case change := <-metaChanges:
+			c.onMetaChange(change)
+		}
+	}
+}
+
+func (c *TcProductCollector) onInstanceChange(change *instance.TcInstanceChange) {
+	instanceChangesTotal.WithLabelValues(c.Namespace, "added").Add(float64(len(change.Added)))
+	instanceChangesTotal.WithLabelValues(c.Namespace, "removed").Add(float64(len(change.Removed)))
+
+	c.lock.RLock()
+	var metrics []*metric.TcmMetric
+	for _, m := range c.MetricMap {
+		if isMetricAffectedByChange(m, change) {
+			metrics = append(metrics, m)
+		}
+	}
+	c.lock.RUnlock()
+
+	for _, m := range metrics {
+		series, err := c.handler.GetSeries(m)
+		if err != nil {
+			level.Error(c.logger).Log("msg", "rebuild metric series err", "err", err,
+				"Namespace", c.Namespace, "name", m.Meta.MetricName)
+			continue
+		}
+		err = m.LoadSeries(series)
+		if err != nil {
+			level.Error(c.logger).Log("msg", "load metric series err", "err", err,
+				"Namespace", c.Namespace, "name", m.Meta.MetricName)
+			continue
+		}
+	}
+	level.Info(c.logger).Log("msg", "Rebuild series after instance change", "Namespace", c.Namespace,
+		"added", len(change.Added), "removed", len(change.Removed), "numMetric", len(metrics))
+}
+
+// 元数据中消失的指标直接删除, 统计周期变化的指标同时在Added和Removed中,
+// 删除后按指标配置和产品配置重新创建, metrics中配置的指标不会丢失
+func (c *TcProductCollector) onMetaChange(change *metric.TcmMetaChange) {
+	c.lock.Lock()
+	for _, meta := range change.Removed {
+		delete(c.MetricMap, meta.MetricName)
+	}
+	c.lock.Unlock()
+
+	if len(change.Added) != 0 {
+		err := c.LoadMetricsByMetricConf()
+		if err != nil {
+			level.Error(c.logger).Log("msg", "reload metrics after meta change err", "err", err,
+				"Namespace", c.Namespace)
+		}
+		err = c.LoadMetricsByProductConf()
+		if err != nil {
+			level.Error(c.logger).Log("msg", "reload metrics after meta change err", "err", err,
+				"Namespace", c.Namespace)
+		}
+	}
+	c.syncQuerys()
+	level.Info(c.logger).Log("msg", "Reload metrics after meta change", "Namespace", c.Namespace,
+		"added", len(change.Added), "removed", len(change.Removed))
+}
+
+// 新增实例影响全实例采集和指定了该实例的指标, 删除实例影响包含该实例series的指标
+func isMetricAffectedByChange(m *metric.TcmMetric, change *instance.TcInstanceChange) bool {
+	for _, ins := range change.Added {
+		if m.Conf.IsIncludeAllInstance() {
+			return true
+		}
+		if util.IsStrInList(m.Conf.OnlyIncludeInstances, ins.GetInstanceId()) {
+			return true
+		}
+	}
+	if len(change.Removed) == 0 {
+		return false
+	}
+	removed := map[string]struct{}{}
+	for _, ins := range change.Removed {
+		removed[ins.GetInstanceId()] = struct{}{}
+	}
+	for _, s := range m.GetSeriesCache().Series {
+		if s.Instance == nil {
+			continue
+		}
+		if _, ok := removed[s.Instance.GetInstanceId()]; ok {
+			return true
+		}
+	}
+	return false
 }
 
 type TcProductCollectorReloader struct {
@@ -305,6 +545,8 @@ type TcProductCollectorReloader struct {
 	ctx            context.Context
 	cancel         context.CancelFunc
 	logger         log.Logger
+	nextRun        time.Time
+	lock           sync.Mutex
 }
 
 func (r *TcProductCollectorReloader) Run() {
@@ -312,7 +554,12 @@ func (r *TcProductCollectorReloader) Run() {
 	defer ticker.Stop()
 
 	// sleep when first start
-	time.Sleep(r.reloadInterval)
+	r.setNextRun(time.Now().Add(r.reloadInterval))
+	select {
+	case <-r.ctx.Done():
+		return
+	case <-time.After(r.reloadInterval):
+	}
 
 	for {
 		level.Info(r.logger).Log("msg", "start reload product metadata", "Namespace", r.collector.Namespace)
@@ -322,6 +569,7 @@ func (r *TcProductCollectorReloader) Run() {
 				"namespace", r.collector.Namespace)
 		}
 		level.Info(r.logger).Log("msg", "complete reload product metadata", "Namespace", r.collector.Namespace)
+		r.setNextRun(time.Now().Add(r.reloadInterval))
 		select {
 		case <-r.ctx.Done():
 			return
@@ -335,7 +583,12 @@ func (r *TcProductCollectorReloader) Stop() {
 }
 
 func (r *TcProductCollectorReloader) reloadMetricsByProductConf() error {
-	return r.collector.LoadMetricsByProductConf()
+	err := r.collector.LoadMetricsByProductConf()
+	if err != nil {
+		return err
+	}
+	r.collector.syncQuerys()
+	return nil
 }
 
 // NewTcProductCollector 创建新的TcProductCollector, 每个产品一个
@@ -362,7 +615,7 @@ func NewTcProductCollector(
 		// var instanceRepo instance.TcInstanceRepository
 		// 使用instance缓存
 		reloadInterval := time.Duration(pconf.ReloadIntervalMinutes * int64(time.Minute))
-		instanceRepoCache = instance.NewTcInstanceCache(instanceRepo, reloadInterval, logger)
+		instanceRepoCache = instance.NewTcInstanceCache(namespace, instanceRepo, reloadInterval, conf.StateDir, logger)
 	}
 
 	c := &TcProductCollector{
@@ -395,6 +648,36 @@ func NewTcProductCollector(
 	return c, nil
 }
 
+// 实例从快照恢复时, 先用快照提供服务, 后台从云API刷新实例后重建所有series, ctx取消后不再重建
+func (c *TcProductCollector) refreshRestoredInstances(ctx context.Context) {
+	restorer, ok := c.InstanceRepo.(instance.TcInstanceSnapshotRestorer)
+	if !ok || !restorer.IsRestored() {
+		return
+	}
+	start := time.Now()
+	err := restorer.Refresh()
+	if err != nil {
+		level.Error(c.logger).Log("msg", "Refresh restored instances fail", "err", err, "Namespace", c.Namespace)
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	err = c.LoadMetricsByMetricConf()
+	if err != nil {
+		level.Error(c.logger).Log("msg", "Reload metrics after refresh fail", "err", err, "Namespace", c.Namespace)
+		return
+	}
+	err = c.LoadMetricsByProductConf()
+	if err != nil {
+		level.Error(c.logger).Log("msg", "Reload metrics after refresh fail", "err", err, "Namespace", c.Namespace)
+		return
+	}
+	c.syncQuerys()
+	level.Info(c.logger).Log("msg", "Refresh restored instances done", "Namespace", c.Namespace,
+		"cost", time.Since(start).Milliseconds())
+}
+
 func NewTcProductCollectorReloader(ctx context.Context, collector *TcProductCollector,
 	reloadInterval time.Duration, logger log.Logger) *TcProductCollectorReloader {
 	childCtx, cancel := context.WithCancel(ctx)
@@ -404,6 +687,7 @@ func NewTcProductCollectorReloader(ctx context.Context, collector *TcProductColl
 		ctx:            childCtx,
 		cancel:         cancel,
 		logger:         logger,
+		nextRun:        time.Now().Add(reloadInterval),
 	}
 	return reloader
 }
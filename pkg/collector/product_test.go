@@ -0,0 +1,118 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+
+	"tencentcloud-exporter/pkg/common"
+	"tencentcloud-exporter/pkg/config"
+	"tencentcloud-exporter/pkg/fakecloud"
+	"tencentcloud-exporter/pkg/metric"
+)
+
+// 产品配置采集CpuUsage, 指标配置采集MemUsage
+func newMetaChangeCollector(t *testing.T, s *fakecloud.Server, metaTTL time.Duration) (*TcProductCollector, metric.TcmMetricRepository) {
+	content := fmt.Sprintf(`credential:
+  access_key: %s
+  secret_key: %s
+  region: ap-guangzhou
+client:
+  endpoint: %s
+products:
+  - namespace: QCE/CVM
+    only_include_metrics: [CpuUsage]
+    all_instances: true
+metrics:
+  - tc_namespace: QCE/CVM
+    tc_metric_name: MemUsage
+    tc_statistics: [max]
+    period_seconds: 60
+`, s.SecretId, s.SecretKey, s.URL())
+	filename := filepath.Join(t.TempDir(), "qcloud.yml")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := config.NewConfig()
+	if err := conf.LoadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	pconf, err := conf.GetProductConfig(CvmNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.NewNopLogger()
+	cred := &common.Credential{SecretId: s.SecretId, SecretKey: s.SecretKey}
+	repo, err := metric.NewTcmMetricRepository(cred, conf, metric.NewTcmBudget(conf, logger), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := metric.NewTcmMetricCache(repo, metaTTL, "", logger)
+	c, err := NewTcProductCollector(CvmNamespace, cache, cred, conf, &pconf, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, cache
+}
+
+func TestProductCollectorMetaChange(t *testing.T) {
+	s := fakecloud.NewServer("AKIDmeta", "meta")
+	defer s.Close()
+	if err := s.LoadFixtures(filepath.Join("testdata", "golden", "cvm")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"CpuUsage", "MemUsage"} {
+		s.AddMetric(fakecloud.NewMetricSet(CvmNamespace, name, "%", "max", []int64{60, 300}, []string{"InstanceId"}))
+	}
+	c, cache := newMetaChangeCollector(t, s, time.Millisecond)
+	if len(c.MetricMap) != 2 {
+		t.Fatalf("want 2 metrics, got %d", len(c.MetricMap))
+	}
+	changes := cache.(metric.TcmMetaChangeNotifier).MetaChanges(CvmNamespace)
+
+	// 两个指标的统计周期都变化, 元数据过期后定时刷新发现变更
+	for _, name := range []string{"CpuUsage", "MemUsage"} {
+		s.AddMetric(fakecloud.NewMetricSet(CvmNamespace, name, "%", "max", []int64{60, 300, 3600}, []string{"InstanceId"}))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.(metaRefresher).RefreshMetaPeriodically(ctx, CvmNamespace)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	var change *metric.TcmMetaChange
+	select {
+	case change = <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no meta change")
+	}
+	if len(change.Added) != 2 || len(change.Removed) != 2 {
+		t.Fatalf("want 2 added and 2 removed, got %d and %d", len(change.Added), len(change.Removed))
+	}
+
+	c.onMetaChange(change)
+	for _, meta := range change.Added {
+		m, ok := c.MetricMap[meta.MetricName]
+		if !ok {
+			t.Fatalf("%s dropped after meta change", meta.MetricName)
+		}
+		if m.Meta != meta {
+			t.Errorf("%s not rebuilt with new meta", meta.MetricName)
+		}
+		if len(m.GetSeriesCache().Series) == 0 {
+			t.Errorf("%s has no series after meta change", meta.MetricName)
+		}
+	}
+	if len(c.Querys) != 2 {
+		t.Errorf("want 2 querys, got %d", len(c.Querys))
+	}
+}
@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"tencentcloud-exporter/pkg/metric"
+)
+
+// exporter当前的运行状态, 用于/status页面和/api/v1/status
+type TcMonitorStatus struct {
+	Config     string                      `json:"config"` // 生效的配置, 凭证已隐藏
+	Collectors []*TcProductCollectorStatus `json:"collectors"`
+}
+
+// 单个产品采集器的状态
+type TcProductCollectorStatus struct {
+	Namespace          string                   `json:"namespace"`
+	NumMetrics         int                      `json:"num_metrics"`
+	NumSeries          int                      `json:"num_series"`
+	NumInstances       int                      `json:"num_instances"`
+	LastCollectTime    time.Time                `json:"last_collect_time"`
+	LastCollectSeconds float64                  `json:"last_collect_seconds"`
+	LastCollectError   string                   `json:"last_collect_error,omitempty"`
+	NextReloadTime     *time.Time               `json:"next_reload_time,omitempty"` // 未开启reload时为空
+	Metrics            []*metric.TcmQueryStatus `json:"metrics"`
+}
+
+// 记录最近一次采集的耗时和错误
+func (c *TcProductCollector) recordCollect(begin time.Time, duration time.Duration, err error) {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+	c.lastCollectTime = begin
+	c.lastCollectDuration = duration
+	c.lastCollectErr = err
+}
+
+func (c *TcProductCollector) Status() *TcProductCollectorStatus {
+	c.lock.RLock()
+	querys := c.Querys
+	c.lock.RUnlock()
+
+	s := &TcProductCollectorStatus{
+		Namespace:  c.Namespace,
+		NumMetrics: len(querys),
+		Metrics:    []*metric.TcmQueryStatus{},
+	}
+	// 实例数按时间线关联的实例统计, 不访问云API
+	instances := map[string]struct{}{}
+	for _, q := range querys {
+		for _, series := range q.Metric.GetSeriesCache().Series {
+			if series.Instance != nil {
+				instances[series.Instance.GetInstanceId()] = struct{}{}
+			}
+		}
+		qs := q.Status()
+		s.NumSeries += qs.NumSeries
+		s.Metrics = append(s.Metrics, qs)
+	}
+	s.NumInstances = len(instances)
+	sort.Slice(s.Metrics, func(i, j int) bool {
+		return s.Metrics[i].MetricName < s.Metrics[j].MetricName
+	})
+
+	c.statusLock.Lock()
+	s.LastCollectTime = c.lastCollectTime
+	s.LastCollectSeconds = c.lastCollectDuration.Seconds()
+	if c.lastCollectErr != nil {
+		s.LastCollectError = c.lastCollectErr.Error()
+	}
+	c.statusLock.Unlock()
+	return s
+}
+
+// 下次reload的时间, 首次reload之前为启动时间加reload间隔
+func (r *TcProductCollectorReloader) NextRun() time.Time {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.nextRun
+}
+
+func (r *TcProductCollectorReloader) setNextRun(t time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.nextRun = t
+}
+
+// 所有产品采集器的状态, 按namespace排序
+func (n *TcMonitorCollector) Status() *TcMonitorStatus {
+	status := &TcMonitorStatus{Collectors: []*TcProductCollectorStatus{}}
+	if b, err := yaml.Marshal(n.config.Redacted()); err == nil {
+		status.Config = string(b)
+	} else {
+		status.Config = err.Error()
+	}
+	for namespace, c := range n.Collectors {
+		s := c.Status()
+		if r, ok := n.Reloaders[namespace]; ok {
+			next := r.NextRun()
+			s.NextReloadTime = &next
+		}
+		status.Collectors = append(status.Collectors, s)
+	}
+	sort.Slice(status.Collectors, func(i, j int) bool {
+		return status.Collectors[i].Namespace < status.Collectors[j].Namespace
+	})
+	return status
+}
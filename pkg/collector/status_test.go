@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"tencentcloud-exporter/pkg/common"
+	"tencentcloud-exporter/pkg/fakecloud"
+	"tencentcloud-exporter/pkg/metric"
+)
+
+func TestProductCollectorStatus(t *testing.T) {
+	c := newLintProductCollector(t, CvmNamespace)
+	s := c.Status()
+	assert.Equal(t, 1, s.NumMetrics)
+	assert.Equal(t, 2, s.NumSeries)
+	assert.Equal(t, 1, s.NumInstances)
+	assert.Equal(t, "never", s.Metrics[0].Status)
+
+	r := prometheus.NewRegistry()
+	r.MustRegister(&lintCollector{product: c})
+	if _, err := r.Gather(); err != nil {
+		t.Fatal(err)
+	}
+	s = c.Status()
+	assert.Equal(t, lintMetricName, s.Metrics[0].MetricName)
+	assert.Equal(t, "done", s.Metrics[0].Status)
+	assert.Empty(t, s.Metrics[0].LatestError)
+	assert.False(t, s.Metrics[0].LatestQueryTime.IsZero())
+	assert.NotZero(t, s.Metrics[0].LatestPoints)
+}
+
+func TestProductCollectorQueryMetrics(t *testing.T) {
+	c := newLintProductCollector(t, CvmNamespace)
+	ch := make(chan prometheus.Metric, 100)
+	assert.NoError(t, c.Collect(context.Background(), ch))
+	close(ch)
+	// 成功时导出tcm_query_success、series、samples_returned和empty_series
+	var n int
+	for pm := range ch {
+		if strings.Contains(pm.Desc().String(), `"tcm_query_`) {
+			n++
+		}
+	}
+	assert.Equal(t, 4, n)
+
+	// GetMonitorData返回不可重试的错误时, 查询失败并返回错误
+	fc := fakecloud.NewServer("AKIDstatus", "status")
+	defer fc.Close()
+	if err := fc.LoadFixtures(filepath.Join("testdata", "golden", "cvm")); err != nil {
+		t.Fatal(err)
+	}
+	fc.AddMetric(fakecloud.NewMetricSet(CvmNamespace, "CpuUsage", "%", "max", []int64{60, 300}, []string{"InstanceId"}))
+	fc.SetMetricValues(CvmNamespace, "CpuUsage", goldenValue)
+	fc.InjectFault("monitor", "GetMonitorData", fakecloud.Fault{Error: fakecloud.NewError("InvalidParameter", "bad dimension")})
+	conf := loadGoldenConfig(t, fc, CvmNamespace)
+	pconf, err := conf.GetProductConfig(CvmNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.NewNopLogger()
+	cred := &common.Credential{SecretId: fc.SecretId, SecretKey: fc.SecretKey}
+	repo, err := metric.NewTcmMetricRepository(cred, conf, metric.NewTcmBudget(conf, logger), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = NewTcProductCollector(CvmNamespace, repo, cred, conf, &pconf, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch = make(chan prometheus.Metric, 100)
+	err = c.Collect(context.Background(), ch)
+	close(ch)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "CpuUsage: ")
+		assert.Contains(t, err.Error(), "InvalidParameter")
+	}
+	n = 0
+	for pm := range ch {
+		var m dto.Metric
+		assert.NoError(t, pm.Write(&m))
+		assert.Contains(t, pm.Desc().String(), "tcm_query_success")
+		assert.Equal(t, float64(0), m.GetGauge().GetValue())
+		n++
+	}
+	assert.Equal(t, 1, n)
+	s := c.Status()
+	assert.Contains(t, s.Metrics[0].LatestError, "InvalidParameter")
+}
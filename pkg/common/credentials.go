@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -16,7 +17,7 @@ type CredentialIface interface {
 	GetToken() string
 	GetSecretKey() string
 	GetCredential() (string, string, string)
-	Refresh() error
+	Refresh(ctx context.Context) error
 	GetRole() string
 }
 
@@ -38,11 +39,14 @@ type metadataResponse struct {
 	Code         string
 }
 
-func (c *Credential) Refresh() error {
+// 定期刷新临时密钥, ctx结束时返回
+func (c *Credential) Refresh(ctx context.Context) error {
 	tick := time.NewTicker(10 * time.Minute)
 	defer tick.Stop()
 	for {
 		select {
+		case <-ctx.Done():
+			return nil
 		case <-tick.C:
 			err := c.refresh()
 			if err != nil {
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	RelabelReplace   = "replace"
+	RelabelKeep      = "keep"
+	RelabelDrop      = "drop"
+	RelabelLabelDrop = "labeldrop"
+	RelabelLabelKeep = "labelkeep"
+	RelabelLabelMap  = "labelmap"
+	RelabelHashMod   = "hashmod"
+
+	defaultRelabelSeparator   = ";"
+	defaultRelabelRegex       = "(.*)"
+	defaultRelabelReplacement = "$1"
+)
+
+var supportRelabelActions = map[string]bool{
+	RelabelReplace:   true,
+	RelabelKeep:      true,
+	RelabelDrop:      true,
+	RelabelLabelDrop: true,
+	RelabelLabelKeep: true,
+	RelabelLabelMap:  true,
+	RelabelHashMod:   true,
+}
+
+// 与Prometheus的metric_relabel_configs一致, 在导出前修改标签, 指标名为__name__
+type RelabelConfig struct {
+	SourceLabels []string `yaml:"source_labels"`
+	Separator    string   `yaml:"separator"`
+	Regex        string   `yaml:"regex"`
+	Modulus      uint64   `yaml:"modulus"`
+	TargetLabel  string   `yaml:"target_label"`
+	Replacement  string   `yaml:"replacement"`
+	Action       string   `yaml:"action"`
+
+	regex *regexp.Regexp
+}
+
+// 正则和Prometheus一样两端锚定
+func (c *RelabelConfig) GetRegex() *regexp.Regexp {
+	return c.regex
+}
+
+// 未配置的字段使用Prometheus的默认值, replacement可以配置为空字符串
+func (c *RelabelConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain RelabelConfig
+	*c = RelabelConfig{
+		Separator:   defaultRelabelSeparator,
+		Regex:       defaultRelabelRegex,
+		Replacement: defaultRelabelReplacement,
+		Action:      RelabelReplace,
+	}
+	return unmarshal((*plain)(c))
+}
+
+// 检查配置并编译正则
+func (c *RelabelConfig) compile() error {
+	c.Action = strings.ToLower(c.Action)
+	if !supportRelabelActions[c.Action] {
+		return fmt.Errorf("relabel action not support, %s", c.Action)
+	}
+	regex, err := regexp.Compile("^(?:" + c.Regex + ")$")
+	if err != nil {
+		return fmt.Errorf("relabel regex invalid, %s", err)
+	}
+	c.regex = regex
+
+	switch c.Action {
+	case RelabelReplace, RelabelHashMod:
+		if c.TargetLabel == "" {
+			return fmt.Errorf("relabel action %s requires target_label", c.Action)
+		}
+	}
+	if c.Action == RelabelHashMod && c.Modulus == 0 {
+		return fmt.Errorf("relabel action hashmod requires modulus")
+	}
+	if (c.Action == RelabelKeep || c.Action == RelabelDrop) && len(c.SourceLabels) == 0 {
+		return fmt.Errorf("relabel action %s requires source_labels", c.Action)
+	}
+	return nil
+}
+
+func compileRelabelConfigs(configs []*RelabelConfig) error {
+	for _, c := range configs {
+		if err := c.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"strings"
+	"text/template"
+
+	"tencentcloud-exporter/pkg/util"
+)
+
+// 指标名模板可以使用的函数
+var metricNameTemplateFuncs = template.FuncMap{
+	"snake":      util.ToUnderlineLower,
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+}
+
+// 解析metric_name_template, 如 tencent_{{.Product}}_{{snake .Metric}}_{{.Stat}}
+func ParseMetricNameTemplate(text string) (*template.Template, error) {
+	return template.New("metric_name").Funcs(metricNameTemplateFuncs).Option("missingkey=error").Parse(text)
+}
@@ -0,0 +1,65 @@
+package fakecloud
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// COS的签名参数, 如q-sign-algorithm=sha1&q-ak=xxx&...
+const cosSignAlgorithm = "q-sign-algorithm="
+
+func isCosRequest(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Authorization"), cosSignAlgorithm)
+}
+
+// COS请求映射的action, 目前只支持GetService
+func cosAction(r *http.Request) string {
+	if r.Method == http.MethodGet && r.URL.Path == "/" {
+		return "GetService"
+	}
+	return r.Method + " " + r.URL.Path
+}
+
+// COS使用XML接口和单独的签名, 只校验签名中的SecretId
+func (s *Server) serveCos(w http.ResponseWriter, r *http.Request, body []byte) {
+	// q-header-list等参数用分号分隔, ParseQuery会返回错误, 但q-ak仍能解析
+	values, _ := url.ParseQuery(r.Header.Get("Authorization"))
+	if values.Get("q-ak") != s.SecretId {
+		s.writeCosError(w, http.StatusForbidden, NewError("InvalidAccessKeyId", "secret id not found"))
+		return
+	}
+	req := &Request{
+		Service: "cos",
+		Action:  cosAction(r),
+		Body:    body,
+	}
+	response, e := s.serve(r, req)
+	if e != nil {
+		s.writeCosError(w, http.StatusBadRequest, e)
+		return
+	}
+	if raw, ok := response.(*RawResponse); ok {
+		s.writeRaw(w, raw)
+		return
+	}
+	b, err := xml.Marshal(response)
+	if err != nil {
+		s.writeCosError(w, http.StatusInternalServerError, NewError("InternalError", err.Error()))
+		return
+	}
+	s.writeRaw(w, &RawResponse{ContentType: "application/xml", Body: b})
+}
+
+func (s *Server) writeCosError(w http.ResponseWriter, status int, e *Error) {
+	b, _ := xml.Marshal(struct {
+		XMLName   xml.Name `xml:"Error"`
+		Code      string
+		Message   string
+		RequestId string
+	}{Code: e.Code, Message: e.Message, RequestId: s.nextRequestId()})
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write(b)
+}
@@ -0,0 +1,165 @@
+package fakecloud
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	monitor "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/monitor/v20180724"
+)
+
+// 云监控的时间参数是北京时间
+var monitorLocation = time.FixedZone("CST", 8*3600)
+
+const monitorTimeFormat = "2006-01-02 15:04:05"
+
+// 按实例纬度和时间生成数据点, false表示该时间点没有数据
+type ValueFunc func(dimensions map[string]string, timestamp int64) (float64, bool)
+
+type metricFixture struct {
+	meta   *monitor.MetricSet
+	values ValueFunc
+}
+
+// 添加指标元数据, 用于DescribeBaseMetrics
+func (s *Server) AddMetric(meta *monitor.MetricSet) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, m := range s.metrics {
+		if *m.meta.Namespace == *meta.Namespace && *m.meta.MetricName == *meta.MetricName {
+			m.meta = meta
+			return
+		}
+	}
+	s.metrics = append(s.metrics, &metricFixture{meta: meta})
+}
+
+// 设置指标的数据点, 用于GetMonitorData, 未设置时返回没有数据点的实例
+func (s *Server) SetMetricValues(namespace string, metricName string, values ValueFunc) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, m := range s.metrics {
+		if *m.meta.Namespace == namespace && *m.meta.MetricName == metricName {
+			m.values = values
+			return
+		}
+	}
+	s.metrics = append(s.metrics, &metricFixture{
+		meta:   &monitor.MetricSet{Namespace: &namespace, MetricName: &metricName},
+		values: values,
+	})
+}
+
+// 生成一个指标元数据, 每个周期的统计方式相同
+func NewMetricSet(namespace string, metricName string, unit string, statType string, periods []int64, dimensions []string) *monitor.MetricSet {
+	m := &monitor.MetricSet{
+		Namespace:  &namespace,
+		MetricName: &metricName,
+		Unit:       &unit,
+		Meaning:    &monitor.MetricObjectMeaning{En: &metricName, Zh: &metricName},
+	}
+	for _, p := range periods {
+		period, text, st := p, strconv.FormatInt(p, 10), statType
+		m.Period = append(m.Period, &period)
+		m.Periods = append(m.Periods, &monitor.PeriodsSt{Period: &text, StatType: []*string{&st}})
+	}
+	var dims []*string
+	for _, d := range dimensions {
+		dim := d
+		dims = append(dims, &dim)
+	}
+	m.Dimensions = []*monitor.DimensionsDesc{{Dimensions: dims}}
+	return m
+}
+
+func (s *Server) describeBaseMetrics(req *Request) (interface{}, error) {
+	var params monitor.DescribeBaseMetricsRequestParams
+	if err := req.Decode(&params); err != nil {
+		return nil, NewError("InvalidParameter", err.Error())
+	}
+	if params.Namespace == nil {
+		return nil, NewError("MissingParameter", "Namespace is required")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	metricSet := []*monitor.MetricSet{}
+	for _, m := range s.metrics {
+		if *m.meta.Namespace != *params.Namespace || m.meta.Period == nil {
+			continue
+		}
+		if params.MetricName != nil && *params.MetricName != *m.meta.MetricName {
+			continue
+		}
+		metricSet = append(metricSet, m.meta)
+	}
+	return &monitor.DescribeBaseMetricsResponseParams{MetricSet: metricSet}, nil
+}
+
+func (s *Server) getMonitorData(req *Request) (interface{}, error) {
+	var params monitor.GetMonitorDataRequestParams
+	if err := req.Decode(&params); err != nil {
+		return nil, NewError("InvalidParameter", err.Error())
+	}
+	if params.Namespace == nil || params.MetricName == nil || params.StartTime == nil {
+		return nil, NewError("MissingParameter", "Namespace, MetricName and StartTime are required")
+	}
+	period := int64(300)
+	if params.Period != nil {
+		period = int64(*params.Period)
+	}
+	st, err := time.ParseInLocation(monitorTimeFormat, *params.StartTime, monitorLocation)
+	if err != nil {
+		return nil, NewError("InvalidParameter.StartTime", err.Error())
+	}
+	et := time.Now()
+	if params.EndTime != nil {
+		if et, err = time.ParseInLocation(monitorTimeFormat, *params.EndTime, monitorLocation); err != nil {
+			return nil, NewError("InvalidParameter.EndTime", err.Error())
+		}
+	}
+
+	s.lock.Lock()
+	var fixture *metricFixture
+	for _, m := range s.metrics {
+		if *m.meta.Namespace == *params.Namespace && *m.meta.MetricName == *params.MetricName {
+			fixture = m
+		}
+	}
+	s.lock.Unlock()
+	if fixture == nil {
+		return nil, NewError("ResourceNotFound", "metric not found")
+	}
+
+	dataPoints := []*monitor.DataPoint{}
+	for _, ins := range params.Instances {
+		dimensions := map[string]string{}
+		dp := &monitor.DataPoint{Timestamps: []*float64{}, Values: []*float64{}}
+		for _, d := range ins.Dimensions {
+			dimensions[*d.Name] = *d.Value
+			dp.Dimensions = append(dp.Dimensions, &monitor.Dimension{Name: d.Name, Value: d.Value})
+		}
+		sort.Slice(dp.Dimensions, func(i, j int) bool { return *dp.Dimensions[i].Name < *dp.Dimensions[j].Name })
+		// 数据点按统计周期对齐
+		for ts := (st.Unix() + period - 1) / period * period; ts <= et.Unix(); ts += period {
+			if fixture.values == nil {
+				break
+			}
+			v, ok := fixture.values(dimensions, ts)
+			if !ok {
+				continue
+			}
+			timestamp, value := float64(ts), v
+			dp.Timestamps = append(dp.Timestamps, &timestamp)
+			dp.Values = append(dp.Values, &value)
+		}
+		dataPoints = append(dataPoints, dp)
+	}
+	p := uint64(period)
+	return &monitor.GetMonitorDataResponseParams{
+		Period:     &p,
+		MetricName: params.MetricName,
+		DataPoints: dataPoints,
+		StartTime:  params.StartTime,
+		EndTime:    params.EndTime,
+	}, nil
+}
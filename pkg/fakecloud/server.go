@@ -0,0 +1,433 @@
+package fakecloud
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 进程内的云API服务, 按TC3-HMAC-SHA256校验签名后返回预置的响应, 用于不访问真实账号的测试.
+// 也支持COS的GetService接口
+type Server struct {
+	SecretId  string
+	SecretKey string
+
+	server    *httptest.Server
+	lock      sync.Mutex
+	handlers  map[string]Handler
+	faults    map[string]*Fault
+	requests  []*Request
+	requestId int64
+
+	metrics []*metricFixture
+}
+
+// 一次云API调用
+type Request struct {
+	Service string
+	Action  string
+	Version string
+	Region  string
+	Body    []byte
+}
+
+// 解析请求参数, 如monitor.GetMonitorDataRequestParams
+func (r *Request) Decode(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// 处理一个action, 返回的对象序列化后作为Response, RequestId自动添加
+type Handler func(req *Request) (interface{}, error)
+
+// 原样返回的响应体, 用于COS等非json接口
+type RawResponse struct {
+	ContentType string
+	Body        []byte
+}
+
+// 云API返回的错误, 其它类型的error按InternalError返回
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func NewError(code string, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// 注入的延迟和错误, 先等待Latency再返回Error
+type Fault struct {
+	Latency time.Duration
+	Error   *Error
+	Times   int // 生效次数, 0表示一直生效
+}
+
+// 设置某个action的处理逻辑, action为空表示该产品的所有action
+func (s *Server) Handle(service string, action string, handler Handler) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.handlers[apiKey(service, action)] = handler
+}
+
+// 返回固定的响应, response可以是对象或json字符串
+func (s *Server) HandleResponse(service string, action string, response interface{}) {
+	if text, ok := response.(string); ok {
+		response = json.RawMessage(text)
+	}
+	s.Handle(service, action, func(req *Request) (interface{}, error) {
+		return response, nil
+	})
+}
+
+// 按请求的Offset和Limit分页返回items, 用于Describe*实例接口, 如HandleList("cvm", "DescribeInstances", "InstanceSet", instances)
+func (s *Server) HandleList(service string, action string, field string, items interface{}) {
+	var list []json.RawMessage
+	b, err := json.Marshal(items)
+	if err == nil {
+		err = json.Unmarshal(b, &list)
+	}
+	s.Handle(service, action, func(req *Request) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		var params struct {
+			Offset *json.Number
+			Limit  *json.Number
+		}
+		if e := req.Decode(&params); e != nil {
+			return nil, NewError("InvalidParameter", e.Error())
+		}
+		offset, limit := 0, len(list)
+		if params.Offset != nil {
+			if v, e := params.Offset.Int64(); e == nil {
+				offset = int(v)
+			}
+		}
+		if params.Limit != nil {
+			if v, e := params.Limit.Int64(); e == nil && v > 0 {
+				limit = int(v)
+			}
+		}
+		if offset > len(list) {
+			offset = len(list)
+		}
+		end := offset + limit
+		if end > len(list) {
+			end = len(list)
+		}
+		return map[string]interface{}{
+			field:        list[offset:end],
+			"TotalCount": len(list),
+		}, nil
+	})
+}
+
+// 从目录加载固定响应, 文件为<service>/<Action>.json, 内容为Response的json;
+// COS等XML接口为<service>/<Action>.xml, 内容原样返回
+func (s *Server) LoadFixtures(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*", "*"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		ext := filepath.Ext(file)
+		if ext != ".json" && ext != ".xml" {
+			continue
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		service := filepath.Base(filepath.Dir(file))
+		action := strings.TrimSuffix(filepath.Base(file), ext)
+		if ext == ".xml" {
+			s.HandleResponse(service, action, &RawResponse{ContentType: "application/xml", Body: content})
+			continue
+		}
+		if !json.Valid(content) {
+			return fmt.Errorf("fixture %s is not valid json", file)
+		}
+		s.HandleResponse(service, action, string(content))
+	}
+	return nil
+}
+
+// 注入延迟或错误, action为空表示该产品的所有action
+func (s *Server) InjectFault(service string, action string, fault Fault) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f := fault
+	s.faults[apiKey(service, action)] = &f
+}
+
+func (s *Server) ClearFaults() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = map[string]*Fault{}
+}
+
+// 已收到的请求, action为空表示该产品的所有请求
+func (s *Server) Requests(service string, action string) []*Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var requests []*Request
+	for _, r := range s.requests {
+		if !strings.EqualFold(r.Service, service) {
+			continue
+		}
+		if action != "" && !strings.EqualFold(r.Action, action) {
+			continue
+		}
+		requests = append(requests, r)
+	}
+	return requests
+}
+
+// 用于client.endpoint的地址
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.writeError(w, NewError("InternalError", err.Error()))
+		return
+	}
+	if isCosRequest(r) {
+		s.serveCos(w, r, body)
+		return
+	}
+	service, e := s.verify(r, body)
+	if e != nil {
+		s.writeError(w, e)
+		return
+	}
+	if r.Method == http.MethodGet {
+		params := map[string]string{}
+		for k, v := range r.URL.Query() {
+			params[k] = v[0]
+		}
+		body, _ = json.Marshal(params)
+	}
+	req := &Request{
+		Service: service,
+		Action:  r.Header.Get("X-TC-Action"),
+		Version: r.Header.Get("X-TC-Version"),
+		Region:  r.Header.Get("X-TC-Region"),
+		Body:    body,
+	}
+	response, e := s.serve(r, req)
+	if e != nil {
+		s.writeError(w, e)
+		return
+	}
+	s.writeResponse(w, response)
+}
+
+// 记录请求, 执行注入的故障后调用对应的handler
+func (s *Server) serve(r *http.Request, req *Request) (interface{}, *Error) {
+	s.lock.Lock()
+	s.requests = append(s.requests, req)
+	fault := s.takeFault(req)
+	handler, ok := s.handlers[apiKey(req.Service, req.Action)]
+	if !ok {
+		handler, ok = s.handlers[apiKey(req.Service, "")]
+	}
+	s.lock.Unlock()
+
+	if fault != nil {
+		if fault.Latency > 0 {
+			select {
+			case <-time.After(fault.Latency):
+			case <-r.Context().Done():
+				return nil, NewError("RequestCanceled", r.Context().Err().Error())
+			}
+		}
+		if fault.Error != nil {
+			return nil, fault.Error
+		}
+	}
+	if !ok {
+		return nil, NewError("InvalidAction", fmt.Sprintf("action %s/%s not found", req.Service, req.Action))
+	}
+	response, err := handler(req)
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			return nil, e
+		}
+		return nil, NewError("InternalError", err.Error())
+	}
+	return response, nil
+}
+
+// 取出生效的故障, 需要持有锁
+func (s *Server) takeFault(req *Request) *Fault {
+	for _, key := range []string{apiKey(req.Service, req.Action), apiKey(req.Service, "")} {
+		f, ok := s.faults[key]
+		if !ok {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				delete(s.faults, key)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// 按sdk的签名方法校验Authorization, 返回签名中的产品名
+func (s *Server) verify(r *http.Request, body []byte) (string, *Error) {
+	authorization := r.Header.Get("Authorization")
+	const algorithm = "TC3-HMAC-SHA256"
+	if !strings.HasPrefix(authorization, algorithm+" ") {
+		return "", NewError("AuthFailure.SignatureFailure", "only TC3-HMAC-SHA256 is supported")
+	}
+	fields := map[string]string{}
+	for _, item := range strings.Split(strings.TrimPrefix(authorization, algorithm+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+	scope := strings.Split(fields["Credential"], "/")
+	if len(scope) != 4 || scope[3] != "tc3_request" {
+		return "", NewError("AuthFailure.SignatureFailure", "invalid credential scope")
+	}
+	secretId, date, service := scope[0], scope[1], scope[2]
+	if secretId != s.SecretId {
+		return "", NewError("AuthFailure.SecretIdNotFound", "secret id not found")
+	}
+
+	var headers []string
+	for _, name := range strings.Split(fields["SignedHeaders"], ";") {
+		value := r.Header.Get(name)
+		if strings.EqualFold(name, "host") {
+			value = r.Host
+		}
+		headers = append(headers, strings.ToLower(name)+":"+value+"\n")
+	}
+	payload := sha256hex(string(body))
+	if r.Header.Get("X-TC-Content-SHA256") == "UNSIGNED-PAYLOAD" {
+		payload = sha256hex("UNSIGNED-PAYLOAD")
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		"/",
+		r.URL.RawQuery,
+		strings.Join(headers, ""),
+		fields["SignedHeaders"],
+		payload,
+	}, "\n")
+	string2sign := strings.Join([]string{
+		algorithm,
+		r.Header.Get("X-TC-Timestamp"),
+		strings.Join(scope[1:], "/"),
+		sha256hex(canonicalRequest),
+	}, "\n")
+	secretDate := hmacsha256(date, "TC3"+s.SecretKey)
+	secretService := hmacsha256(service, secretDate)
+	secretSigning := hmacsha256("tc3_request", secretService)
+	signature := hex.EncodeToString([]byte(hmacsha256(string2sign, secretSigning)))
+	if !hmac.Equal([]byte(signature), []byte(fields["Signature"])) {
+		return "", NewError("AuthFailure.SignatureFailure", "signature mismatch")
+	}
+	return service, nil
+}
+
+func (s *Server) nextRequestId() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requestId++
+	return fmt.Sprintf("fakecloud-%d", s.requestId)
+}
+
+func (s *Server) writeResponse(w http.ResponseWriter, response interface{}) {
+	if raw, ok := response.(*RawResponse); ok {
+		s.writeRaw(w, raw)
+		return
+	}
+	fields := map[string]json.RawMessage{}
+	b, err := json.Marshal(response)
+	if err == nil && string(b) != "null" {
+		err = json.Unmarshal(b, &fields)
+	}
+	if err != nil {
+		s.writeError(w, NewError("InternalError", err.Error()))
+		return
+	}
+	fields["RequestId"], _ = json.Marshal(s.nextRequestId())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"Response": fields})
+}
+
+func (s *Server) writeRaw(w http.ResponseWriter, raw *RawResponse) {
+	if raw.ContentType != "" {
+		w.Header().Set("Content-Type", raw.ContentType)
+	}
+	w.Write(raw.Body)
+}
+
+// 云API的错误也返回200, 错误信息在Response.Error中
+func (s *Server) writeError(w http.ResponseWriter, e *Error) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"Response": map[string]interface{}{
+			"Error": map[string]string{
+				"Code":    e.Code,
+				"Message": e.Message,
+			},
+			"RequestId": s.nextRequestId(),
+		},
+	})
+}
+
+func apiKey(service string, action string) string {
+	return strings.ToLower(service + "/" + action)
+}
+
+func sha256hex(s string) string {
+	b := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(b[:])
+}
+
+func hmacsha256(s string, key string) string {
+	hashed := hmac.New(sha256.New, []byte(key))
+	hashed.Write([]byte(s))
+	return string(hashed.Sum(nil))
+}
+
+// 启动服务, 内置云监控的DescribeBaseMetrics和GetMonitorData
+func NewServer(secretId string, secretKey string) *Server {
+	s := &Server{
+		SecretId:  secretId,
+		SecretKey: secretKey,
+		handlers:  map[string]Handler{},
+		faults:    map[string]*Fault{},
+	}
+	s.Handle("monitor", "DescribeBaseMetrics", s.describeBaseMetrics)
+	s.Handle("monitor", "GetMonitorData", s.getMonitorData)
+	s.server = httptest.NewServer(s)
+	return s
+}
@@ -0,0 +1,117 @@
+package fakecloud
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
+	cvm "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cvm/v20170312"
+	monitor "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/monitor/v20180724"
+)
+
+func newProfile(t *testing.T, s *Server) *profile.ClientProfile {
+	u, err := url.Parse(s.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpf := profile.NewClientProfile()
+	cpf.HttpProfile.Scheme = "HTTP"
+	cpf.HttpProfile.Endpoint = u.Host
+	return cpf
+}
+
+func newMonitorClient(t *testing.T, s *Server, secretKey string) *monitor.Client {
+	cli, err := monitor.NewClient(common.NewCredential(s.SecretId, secretKey), "ap-guangzhou", newProfile(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cli
+}
+
+func Test_Signature(t *testing.T) {
+	s := NewServer("AKID", "secret")
+	defer s.Close()
+	s.AddMetric(NewMetricSet("QCE/CVM", "CpuUsage", "%", "max", []int64{60, 300}, []string{"InstanceId"}))
+
+	request := monitor.NewDescribeBaseMetricsRequest()
+	request.Namespace = common.StringPtr("QCE/CVM")
+	response, err := newMonitorClient(t, s, "secret").DescribeBaseMetrics(request)
+	assert.NoError(t, err)
+	assert.Len(t, response.Response.MetricSet, 1)
+	assert.Equal(t, "ap-guangzhou", s.Requests("monitor", "DescribeBaseMetrics")[0].Region)
+
+	_, err = newMonitorClient(t, s, "wrong").DescribeBaseMetrics(request)
+	sdkErr, ok := err.(*errors.TencentCloudSDKError)
+	assert.True(t, ok)
+	assert.Equal(t, "AuthFailure.SignatureFailure", sdkErr.Code)
+}
+
+func Test_GetMonitorData(t *testing.T) {
+	s := NewServer("AKID", "secret")
+	defer s.Close()
+	s.AddMetric(NewMetricSet("QCE/CVM", "CpuUsage", "%", "max", []int64{60}, []string{"InstanceId"}))
+	s.SetMetricValues("QCE/CVM", "CpuUsage", func(dimensions map[string]string, ts int64) (float64, bool) {
+		if dimensions["InstanceId"] == "ins-nodata" {
+			return 0, false
+		}
+		return float64(ts % 3600), true
+	})
+
+	now := time.Now().Truncate(time.Minute)
+	request := monitor.NewGetMonitorDataRequest()
+	request.Namespace = common.StringPtr("QCE/CVM")
+	request.MetricName = common.StringPtr("CpuUsage")
+	request.Period = common.Uint64Ptr(60)
+	request.StartTime = common.StringPtr(now.Add(-2 * time.Minute).In(monitorLocation).Format(monitorTimeFormat))
+	request.EndTime = common.StringPtr(now.In(monitorLocation).Format(monitorTimeFormat))
+	for _, id := range []string{"ins-1", "ins-nodata"} {
+		request.Instances = append(request.Instances, &monitor.Instance{
+			Dimensions: []*monitor.Dimension{{Name: common.StringPtr("InstanceId"), Value: common.StringPtr(id)}},
+		})
+	}
+	response, err := newMonitorClient(t, s, "secret").GetMonitorData(request)
+	assert.NoError(t, err)
+	assert.Len(t, response.Response.DataPoints, 2)
+	assert.Len(t, response.Response.DataPoints[0].Values, 3)
+	assert.Equal(t, float64(now.Unix()%3600), *response.Response.DataPoints[0].Values[2])
+	assert.Len(t, response.Response.DataPoints[1].Values, 0)
+}
+
+func Test_HandleListAndFault(t *testing.T) {
+	s := NewServer("AKID", "secret")
+	defer s.Close()
+	var instances []*cvm.Instance
+	for _, id := range []string{"ins-1", "ins-2", "ins-3"} {
+		instances = append(instances, &cvm.Instance{InstanceId: common.StringPtr(id)})
+	}
+	s.HandleList("cvm", "DescribeInstances", "InstanceSet", instances)
+	s.InjectFault("cvm", "", Fault{Latency: 50 * time.Millisecond, Error: NewError("RequestLimitExceeded", "too fast"), Times: 1})
+
+	cli, err := cvm.NewClient(common.NewCredential("AKID", "secret"), "ap-guangzhou", newProfile(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := cvm.NewDescribeInstancesRequest()
+	request.Offset = common.Int64Ptr(2)
+	request.Limit = common.Int64Ptr(2)
+
+	start := time.Now()
+	_, err = cli.DescribeInstances(request)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	assert.True(t, err != nil && strings.Contains(err.Error(), "RequestLimitExceeded"))
+
+	response, err := cli.DescribeInstances(request)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), *response.Response.TotalCount)
+	assert.Len(t, response.Response.InstanceSet, 1)
+	assert.Equal(t, "ins-3", *response.Response.InstanceSet[0].InstanceId)
+	assert.Len(t, s.Requests("cvm", "DescribeInstances"), 2)
+
+	_, err = cli.DescribeRegions(cvm.NewDescribeRegionsRequest())
+	assert.True(t, err != nil && strings.Contains(err.Error(), "InvalidAction"))
+}
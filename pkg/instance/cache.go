@@ -1,6 +1,9 @@
 package instance
 
 import (
+	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,11 +19,42 @@ import (
 	vbc "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/vpc/v20170312"
 )
 
+const instanceChangeBufferSize = 16
+
+// 实例变更事件, 由TcInstanceCache在reload时对比新旧实例集合得到
+type TcInstanceChange struct {
+	Added   []TcInstance
+	Removed []TcInstance
+}
+
+func (c *TcInstanceChange) IsEmpty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0
+}
+
+// 支持实例变更通知的TcInstanceRepository
+type TcInstanceChangeNotifier interface {
+	// 实例变更事件流, 每次reload发现变更时推送一次
+	Changes() <-chan *TcInstanceChange
+}
+
+// 支持从本地快照恢复的TcInstanceRepository
+type TcInstanceSnapshotRestorer interface {
+	// 是否从快照恢复, 从快照恢复的实例需要在后台刷新
+	IsRestored() bool
+	// 忽略reload周期, 强制从云API刷新实例
+	Refresh() error
+}
+
 // 可用于产品的实例的缓存, TcInstanceRepository
 type TcInstanceCache struct {
 	Raw            TcInstanceRepository
+	namespace      string
+	stateDir       string // 为空时不使用快照
+	restored       bool
+	restoredTime   time.Time // 从快照恢复的时间, 后台刷新完成前按该时间判断是否需要reload
 	cache          map[string]TcInstance
-	lastReloadTime time.Time
+	lastReloadTime time.Time // 从云API加载实例的时间, 从快照恢复时为快照中的时间
+	changes        chan *TcInstanceChange
 	logger         log.Logger
 	mu             sync.Mutex
 	reloadInterval time.Duration
@@ -88,36 +122,151 @@ func (c *TcInstanceCache) checkNeedReload() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if !c.lastReloadTime.IsZero() && time.Now().Sub(c.lastReloadTime) < c.reloadInterval {
+	loadedTime := c.lastReloadTime
+	if c.restored {
+		loadedTime = c.restoredTime
+	}
+	if !loadedTime.IsZero() && time.Now().Sub(loadedTime) < c.reloadInterval {
 		return nil
 	}
+	return c.reload()
+}
+
+func (c *TcInstanceCache) IsRestored() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.restored
+}
 
+func (c *TcInstanceCache) Refresh() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reload()
+}
+
+func (c *TcInstanceCache) reload() error {
 	inss, err := c.Raw.ListByFilters(map[string]string{})
 	if err != nil {
 		return err
 	}
-	numChanged := 0
+	change := &TcInstanceChange{}
 	if len(inss) > 0 {
 		newCache := map[string]TcInstance{}
 		for _, instance := range inss {
 			newCache[instance.GetInstanceId()] = instance
 		}
-		numChanged = len(newCache) - len(c.cache)
+		// 首次加载不算变更
+		if !c.lastReloadTime.IsZero() {
+			change = diffInstances(c.cache, newCache)
+		}
 		c.cache = newCache
 	}
 	c.lastReloadTime = time.Now()
+	c.restored = false
+	c.saveSnapshot()
 
-	level.Info(c.logger).Log("msg", "Reload instance cache", "num", len(c.cache), "changed", numChanged)
+	level.Info(c.logger).Log("msg", "Reload instance cache", "num", len(c.cache),
+		"added", len(change.Added), "removed", len(change.Removed))
+	if !change.IsEmpty() {
+		level.Info(c.logger).Log("msg", "Instance changed",
+			"added", strings.Join(instanceIds(change.Added), ","),
+			"removed", strings.Join(instanceIds(change.Removed), ","))
+		c.notify(change)
+	}
 	return nil
 }
 
-func NewTcInstanceCache(repo TcInstanceRepository, reloadInterval time.Duration, logger log.Logger) TcInstanceRepository {
+// 退出前将实例缓存写入快照
+func (c *TcInstanceCache) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stateDir == "" || c.lastReloadTime.IsZero() {
+		return nil
+	}
+	return saveInstanceSnapshot(c.stateDir, c.namespace, c.cache, c.lastReloadTime)
+}
+
+func (c *TcInstanceCache) saveSnapshot() {
+	if c.stateDir == "" {
+		return
+	}
+	err := saveInstanceSnapshot(c.stateDir, c.namespace, c.cache, c.lastReloadTime)
+	if err != nil {
+		level.Warn(c.logger).Log("msg", "Save instance snapshot fail", "err", err, "namespace", c.namespace)
+	}
+}
+
+// 从快照恢复实例缓存, 保留快照中的加载时间, 恢复后reload周期内不同步reload, 由调用方在后台Refresh
+func (c *TcInstanceCache) restoreSnapshot() {
+	if c.stateDir == "" {
+		return
+	}
+	insList, ts, err := loadInstanceSnapshot(c.stateDir, c.namespace)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			level.Warn(c.logger).Log("msg", "Load instance snapshot fail", "err", err, "namespace", c.namespace)
+		}
+		return
+	}
+	c.cache = insList
+	c.lastReloadTime = ts
+	c.restoredTime = time.Now()
+	c.restored = true
+	level.Info(c.logger).Log("msg", "Restore instance cache from snapshot", "namespace", c.namespace,
+		"num", len(insList), "snapshot_time", ts.Format(time.RFC3339))
+}
+
+func (c *TcInstanceCache) Changes() <-chan *TcInstanceChange {
+	return c.changes
+}
+
+// 推送变更事件, 不阻塞reload, 消费不及时则丢弃并等待下次product reload兜底
+func (c *TcInstanceCache) notify(change *TcInstanceChange) {
+	select {
+	case c.changes <- change:
+	default:
+		level.Warn(c.logger).Log("msg", "Instance change stream is full, drop change event",
+			"added", len(change.Added), "removed", len(change.Removed))
+	}
+}
+
+// 按实例id对比新旧实例集合
+func diffInstances(oldCache map[string]TcInstance, newCache map[string]TcInstance) *TcInstanceChange {
+	change := &TcInstanceChange{}
+	for id, ins := range newCache {
+		if _, ok := oldCache[id]; !ok {
+			change.Added = append(change.Added, ins)
+		}
+	}
+	for id, ins := range oldCache {
+		if _, ok := newCache[id]; !ok {
+			change.Removed = append(change.Removed, ins)
+		}
+	}
+	return change
+}
+
+func instanceIds(insList []TcInstance) []string {
+	var ids []string
+	for _, ins := range insList {
+		ids = append(ids, ins.GetInstanceId())
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func NewTcInstanceCache(namespace string, repo TcInstanceRepository, reloadInterval time.Duration,
+	stateDir string, logger log.Logger) TcInstanceRepository {
 	cache := &TcInstanceCache{
 		Raw:            repo,
+		namespace:      namespace,
+		stateDir:       stateDir,
 		cache:          map[string]TcInstance{},
+		changes:        make(chan *TcInstanceChange, instanceChangeBufferSize),
 		reloadInterval: reloadInterval,
 		logger:         logger,
 	}
+	cache.restoreSnapshot()
 	return cache
 }
 
@@ -0,0 +1,89 @@
+package instance
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	sdk "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cvm/v20170312"
+)
+
+func newTestCvmInstance(t *testing.T, id string) TcInstance {
+	ins, err := NewCvmTcInstance(id, &sdk.Instance{InstanceId: &id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ins
+}
+
+func newTestInstanceMap(t *testing.T, ids ...string) map[string]TcInstance {
+	m := map[string]TcInstance{}
+	for _, id := range ids {
+		m[id] = newTestCvmInstance(t, id)
+	}
+	return m
+}
+
+func Test_diffInstances(t *testing.T) {
+	cases := []struct {
+		name    string
+		old     []string
+		new     []string
+		added   []string
+		removed []string
+	}{
+		{"same", []string{"ins-1", "ins-2"}, []string{"ins-2", "ins-1"}, nil, nil},
+		{"added", []string{"ins-1"}, []string{"ins-1", "ins-2", "ins-3"}, []string{"ins-2", "ins-3"}, nil},
+		{"removed", []string{"ins-1", "ins-2"}, []string{"ins-2"}, nil, []string{"ins-1"}},
+		{"replaced", []string{"ins-1"}, []string{"ins-2"}, []string{"ins-2"}, []string{"ins-1"}},
+		{"from empty", nil, []string{"ins-1"}, []string{"ins-1"}, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			change := diffInstances(newTestInstanceMap(t, c.old...), newTestInstanceMap(t, c.new...))
+			assert.Equal(t, c.added, instanceIds(change.Added))
+			assert.Equal(t, c.removed, instanceIds(change.Removed))
+			assert.Equal(t, len(c.added) == 0 && len(c.removed) == 0, change.IsEmpty())
+		})
+	}
+}
+
+// 每次ListByFilters返回不同的实例集合
+type changingInstanceRepository struct {
+	TcInstanceRepository
+	round int
+}
+
+func (r *changingInstanceRepository) ListByFilters(filters map[string]string) ([]TcInstance, error) {
+	r.round++
+	id := fmt.Sprintf("ins-%d", r.round)
+	ins, err := NewCvmTcInstance(id, &sdk.Instance{InstanceId: &id})
+	if err != nil {
+		return nil, err
+	}
+	return []TcInstance{ins}, nil
+}
+
+func Test_TcInstanceCacheDropChangeWhenFull(t *testing.T) {
+	cache := NewTcInstanceCache("QCE/CVM", &changingInstanceRepository{}, time.Hour, "", log.NewNopLogger()).(*TcInstanceCache)
+	// 首次加载不推送变更
+	assert.NoError(t, cache.Refresh())
+	for i := 0; i < instanceChangeBufferSize+3; i++ {
+		assert.NoError(t, cache.Refresh())
+	}
+	assert.Equal(t, instanceChangeBufferSize, len(cache.Changes()))
+
+	// 队列满后丢弃新的变更, 已排队的变更按顺序保留
+	first := <-cache.Changes()
+	assert.Equal(t, []string{"ins-2"}, instanceIds(first.Added))
+	assert.Equal(t, []string{"ins-1"}, instanceIds(first.Removed))
+
+	// 消费后可以继续推送
+	assert.NoError(t, cache.Refresh())
+	assert.Equal(t, instanceChangeBufferSize, len(cache.Changes()))
+	insList, err := cache.ListByFilters(map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{fmt.Sprintf("ins-%d", instanceChangeBufferSize+5)}, instanceIds(insList))
+}
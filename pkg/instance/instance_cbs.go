@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewCbsTcInstance(instanceId string, meta *sdk.Disk) (ins *CbsTcInstance, er
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeCbsTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.Disk{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewCbsTcInstance(instanceId, meta)
+}
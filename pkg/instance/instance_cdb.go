@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewCdbTcInstance(instanceId string, meta *sdk.InstanceInfo) (ins *CdbTcInst
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeCdbTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.InstanceInfo{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewCdbTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewCdnTcInstance(instanceId string, meta *sdk.BriefDomain) (ins *CdnTcInsta
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeCdnTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.BriefDomain{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewCdnTcInstance(instanceId, meta)
+}
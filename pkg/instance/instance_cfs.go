@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewCfsTcInstance(instanceId string, meta *sdk.FileSystemInfo) (ins *CfsTcIn
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeCfsTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.FileSystemInfo{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewCfsTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -42,3 +43,12 @@ func NewClbPrivateTcInstance(instanceId string, meta *sdk.LoadBalancer) (ins *Cl
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeClbPrivateTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.LoadBalancer{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewClbPrivateTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewCMQTcInstance(instanceId string, meta *sdk.QueueSet) (ins *CMQTcInstance
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeCMQTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.QueueSet{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewCMQTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewCMQTopicTcInstance(instanceId string, meta *sdk.TopicSet) (ins *CMQTopic
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeCMQTopicTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.TopicSet{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewCMQTopicTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewCosTcInstance(instanceId string, meta *sdk.Bucket) (ins *CosTcInstance,
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeCosTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.Bucket{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewCosTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewCynosdbTcInstance(instanceId string, meta *sdk.CynosdbInstance) (ins *Cy
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeCynosdbTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.CynosdbInstance{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewCynosdbTcInstance(instanceId, meta)
+}
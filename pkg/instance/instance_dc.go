@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewDcTcInstance(instanceId string, meta *sdk.DirectConnect) (ins *DcTcInsta
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeDcTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.DirectConnect{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewDcTcInstance(instanceId, meta)
+}
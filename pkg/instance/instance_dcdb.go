@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewDcdbTcInstance(instanceId string, meta *sdk.DCDBInstanceInfo) (ins *Dcdb
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeDcdbTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.DCDBInstanceInfo{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewDcdbTcInstance(instanceId, meta)
+}
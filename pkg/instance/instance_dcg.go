@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewDcgTcInstance(instanceId string, meta *sdk.DirectConnectGateway) (ins *D
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeDcgTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.DirectConnectGateway{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewDcgTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewDcxTcInstance(instanceId string, meta *sdk.DirectConnectTunnel) (ins *Dc
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeDcxTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.DirectConnectTunnel{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewDcxTcInstance(instanceId, meta)
+}
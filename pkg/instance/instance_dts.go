@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewDtsTcInstance(instanceId string, meta *sdk.SubscribeInfo) (ins *DtsTcIns
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeDtsTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.SubscribeInfo{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewDtsTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewEIPTcInstance(instanceId string, meta *sdk.Address) (ins *EIPInstance, e
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeEIPTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.Address{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewEIPTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewESTcInstance(instanceId string, meta *sdk.InstanceInfo) (ins *ESTcInstan
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeESTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.InstanceInfo{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewESTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewKafkaTcInstance(instanceId string, meta *sdk.Instance) (ins *kafkaTcInst
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeKafkaTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.Instance{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewKafkaTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewLighthouseTcInstance(instanceId string, meta *sdk.Instance) (ins *Lighth
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeLighthouseTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.Instance{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewLighthouseTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewMemcachedTcInstance(instanceId string, meta *sdk.InstanceListInfo) (ins
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeMemcachedTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.InstanceListInfo{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewMemcachedTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewMongoTcInstance(instanceId string, meta *sdk.InstanceDetail) (ins *Mongo
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeMongoTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.InstanceDetail{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewMongoTcInstance(instanceId, meta)
+}
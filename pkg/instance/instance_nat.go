@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewNatTcInstance(instanceId string, meta *sdk.NatGateway) (ins *NatTcInstan
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeNatTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.NatGateway{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewNatTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewPGTcInstance(instanceId string, meta *sdk.DBInstance) (ins *PGTcInstance
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodePGTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.DBInstance{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewPGTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewQaapTcInstance(instanceId string, meta *sdk.ProxyInfo) (ins *QaapTcInsta
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeQaapTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.ProxyInfo{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewQaapTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewRedisTcInstance(instanceId string, meta *sdk.InstanceSet) (ins *RedisTcI
 func (ins *RedisTcInstance) GetMeta() interface{} {
 	return ins.meta
 }
+
+// 从快照中的元数据恢复实例
+func decodeRedisTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.InstanceSet{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewRedisTcInstance(instanceId, meta)
+}
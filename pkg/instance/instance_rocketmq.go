@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -41,3 +42,12 @@ func NewRocketMQTcInstance(instanceId string, meta *sdk.RocketMQClusterDetail) (
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeRocketMQTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.RocketMQClusterDetail{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewRocketMQTcInstance(instanceId, meta)
+}
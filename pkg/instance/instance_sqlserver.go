@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewSqlServerTcInstance(instanceId string, meta *sdk.DBInstance) (ins *SqlSe
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeSqlServerTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.DBInstance{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewSqlServerTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewTseTcInstance(instanceId string, meta *sdk.SREInstance) (ins *TseTcInsta
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeTseTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.SREInstance{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewTseTcInstance(instanceId, meta)
+}
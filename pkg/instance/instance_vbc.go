@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewVbcTcInstance(instanceId string, meta *sdk.CCN) (ins *VbcTcInstance, err
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeVbcTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.CCN{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewVbcTcInstance(instanceId, meta)
+}
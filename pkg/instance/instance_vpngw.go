@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewVpngwTcInstance(instanceId string, meta *sdk.VpnGateway) (ins *VpngwTcIn
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeVpngwTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.VpnGateway{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewVpngwTcInstance(instanceId, meta)
+}
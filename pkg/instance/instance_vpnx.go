@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewVpnxTcInstance(instanceId string, meta *sdk.VpnConnection) (ins *VpnxTcI
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeVpnxTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.VpnConnection{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewVpnxTcInstance(instanceId, meta)
+}
@@ -1,6 +1,7 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -32,3 +33,12 @@ func NewWafTcInstance(instanceId string, meta *sdk.DomainInfo) (ins *WafTcInstan
 	}
 	return
 }
+
+// 从快照中的元数据恢复实例
+func decodeWafTcInstance(instanceId string, data []byte) (TcInstance, error) {
+	meta := &sdk.DomainInfo{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return NewWafTcInstance(instanceId, meta)
+}
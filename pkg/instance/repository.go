@@ -11,6 +11,8 @@ import (
 
 var (
 	factoryMap = make(map[string]func(common.CredentialIface, *config.TencentConfig, log.Logger) (TcInstanceRepository, error))
+	// 按namespace将快照中的元数据恢复为该产品的实例类型
+	snapshotDecoderMap = make(map[string]func(instanceId string, data []byte) (TcInstance, error))
 )
 
 // 每个产品的实例对象的Repository
@@ -37,3 +39,8 @@ func NewTcInstanceRepository(namespace string, cred common.CredentialIface, conf
 func registerRepository(namespace string, factory func(common.CredentialIface, *config.TencentConfig, log.Logger) (TcInstanceRepository, error)) {
 	factoryMap[namespace] = factory
 }
+
+// 注册从快照恢复实例的方法, 恢复后的实例与从云API获取的类型相同
+func registerSnapshotDecoder(namespace string, decoder func(instanceId string, data []byte) (TcInstance, error)) {
+	snapshotDecoderMap[namespace] = decoder
+}
@@ -16,6 +16,7 @@ import (
 
 func init() {
 	registerRepository("QCE/BLOCK_STORAGE", NewCbsTcInstanceRepository)
+	registerSnapshotDecoder("QCE/BLOCK_STORAGE", decodeCbsTcInstance)
 }
 
 type CbsTcInstanceRepository struct {
@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/CDB", NewCdbTcInstanceRepository)
+	registerSnapshotDecoder("QCE/CDB", decodeCdbTcInstance)
 }
 
 type CdbTcInstanceRepository struct {
@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/CDN", NewCdnTcInstanceRepository)
+	registerSnapshotDecoder("QCE/CDN", decodeCdnTcInstance)
 }
 
 type CdnTcInstanceRepository struct {
@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/CFS", NewCfsTcInstanceRepository)
+	registerSnapshotDecoder("QCE/CFS", decodeCfsTcInstance)
 }
 
 type CfsTcInstanceRepository struct {
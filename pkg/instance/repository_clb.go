@@ -17,7 +17,9 @@ import (
 func init() {
 	// LB_PUBLIC、LOADBALANCE实例对象是一样的
 	registerRepository("QCE/LB_PUBLIC", NewClbTcInstanceRepository)
+	registerSnapshotDecoder("QCE/LB_PUBLIC", decodeClbTcInstance)
 	registerRepository("QCE/LOADBALANCE", NewClbTcInstanceRepository)
+	registerSnapshotDecoder("QCE/LOADBALANCE", decodeClbTcInstance)
 }
 
 var open = "OPEN"
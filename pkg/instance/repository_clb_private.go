@@ -16,6 +16,7 @@ import (
 
 func init() {
 	registerRepository("QCE/LB_PRIVATE", NewClbPrivateTcInstanceRepository)
+	registerSnapshotDecoder("QCE/LB_PRIVATE", decodeClbPrivateTcInstance)
 }
 
 var internal = "INTERNAL"
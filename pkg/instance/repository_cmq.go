@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/CMQ", NewCMQTcInstanceRepository)
+	registerSnapshotDecoder("QCE/CMQ", decodeCMQTcInstance)
 }
 
 type CMQTcInstanceRepository struct {
@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/CMQTOPIC", NewCMQTopicTcInstanceRepository)
+	registerSnapshotDecoder("QCE/CMQTOPIC", decodeCMQTopicTcInstance)
 }
 
 type CMQTopicTcInstanceRepository struct {
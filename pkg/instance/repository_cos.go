@@ -16,6 +16,7 @@ import (
 
 func init() {
 	registerRepository("QCE/COS", NewCosTcInstanceRepository)
+	registerSnapshotDecoder("QCE/COS", decodeCosTcInstance)
 }
 
 type CosTcInstanceRepository struct {
@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/CVM", NewCvmTcInstanceRepository)
+	registerSnapshotDecoder("QCE/CVM", decodeCvmTcInstance)
 }
 
 type CvmTcInstanceRepository struct {
@@ -0,0 +1,58 @@
+package instance
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	sdk "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cvm/v20170312"
+
+	"tencentcloud-exporter/pkg/common"
+	"tencentcloud-exporter/pkg/config"
+	"tencentcloud-exporter/pkg/fakecloud"
+)
+
+func Test_CvmRepositoryWithFakeCloud(t *testing.T) {
+	s := fakecloud.NewServer("AKID", "secret")
+	defer s.Close()
+	var instances []*sdk.Instance
+	for i := 0; i < 150; i++ {
+		id, name := fmt.Sprintf("ins-%03d", i), fmt.Sprintf("cvm-%d", i)
+		instances = append(instances, &sdk.Instance{InstanceId: &id, InstanceName: &name})
+	}
+	s.HandleList("cvm", "DescribeInstances", "InstanceSet", instances)
+
+	content := fmt.Sprintf(`credential:
+  access_key: AKID
+  secret_key: secret
+  region: ap-guangzhou
+client:
+  endpoint: %s
+`, s.URL())
+	filename := filepath.Join(t.TempDir(), "qcloud.yml")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := config.NewConfig()
+	if err := conf.LoadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	cred := &common.Credential{SecretId: "AKID", SecretKey: "secret"}
+	repo, err := NewTcInstanceRepository("QCE/CVM", cred, conf, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := repo.ListByFilters(nil)
+	assert.NoError(t, err)
+	// 每页100个实例, 分2次查询
+	assert.Len(t, list, 150)
+	assert.Len(t, s.Requests("cvm", "DescribeInstances"), 2)
+
+	name, err := list[149].GetFieldValueByName("InstanceName")
+	assert.NoError(t, err)
+	assert.Equal(t, "cvm-149", name)
+}
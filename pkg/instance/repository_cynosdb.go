@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/CYNOSDB_MYSQL", NewCynosdbTcInstanceRepository)
+	registerSnapshotDecoder("QCE/CYNOSDB_MYSQL", decodeCynosdbTcInstance)
 }
 
 var dbType = "MYSQL"
@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/DC", NewDcTcInstanceRepository)
+	registerSnapshotDecoder("QCE/DC", decodeDcTcInstance)
 }
 
 type DcTcInstanceRepository struct {
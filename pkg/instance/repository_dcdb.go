@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/TDMYSQL", NewDcdbTcInstanceRepository)
+	registerSnapshotDecoder("QCE/TDMYSQL", decodeDcdbTcInstance)
 }
 
 type DcdbTcInstanceRepository struct {
@@ -14,6 +14,7 @@ import (
 
 func init() {
 	registerRepository("QCE/DCG", NewDcgTcInstanceRepository)
+	registerSnapshotDecoder("QCE/DCG", decodeDcgTcInstance)
 }
 
 type DcgTcInstanceRepository struct {
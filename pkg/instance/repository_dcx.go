@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/DCX", NewDcxTcInstanceRepository)
+	registerSnapshotDecoder("QCE/DCX", decodeDcxTcInstance)
 }
 
 type DcxTcInstanceRepository struct {
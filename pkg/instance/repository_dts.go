@@ -17,6 +17,7 @@ import (
 
 func init() {
 	registerRepository("QCE/DTS", NewDTSTcInstanceRepository)
+	registerSnapshotDecoder("QCE/DTS", decodeDtsTcInstance)
 }
 
 type DTSTcInstanceRepository struct {
@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/LB", NewEIPTcInstanceRepository)
+	registerSnapshotDecoder("QCE/LB", decodeEIPTcInstance)
 }
 
 type EIPTcInstanceRepository struct {
@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/CES", NewESTcInstanceRepository)
+	registerSnapshotDecoder("QCE/CES", decodeESTcInstance)
 }
 
 type ESTcInstanceRepository struct {
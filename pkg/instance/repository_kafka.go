@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/CKAFKA", NewKafkaTcInstanceRepository)
+	registerSnapshotDecoder("QCE/CKAFKA", decodeKafkaTcInstance)
 }
 
 type KafkaTcInstanceRepository struct {
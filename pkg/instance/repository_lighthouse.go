@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/LIGHTHOUSE", NewLighthouseTcInstanceRepository)
+	registerSnapshotDecoder("QCE/LIGHTHOUSE", decodeLighthouseTcInstance)
 }
 
 type LighthouseTcInstanceRepository struct {
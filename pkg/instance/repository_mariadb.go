@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/MARIADB", NewMariaDBTcInstanceRepository)
+	registerSnapshotDecoder("QCE/MARIADB", decodeMariaDBTcInstance)
 }
 
 type MariaDBTcInstanceRepository struct {
@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/MEMCACHED", NewMemcachedTcInstanceRepository)
+	registerSnapshotDecoder("QCE/MEMCACHED", decodeMemcachedTcInstance)
 }
 
 type MemcachedTcInstanceRepository struct {
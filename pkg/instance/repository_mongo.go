@@ -16,6 +16,7 @@ import (
 
 func init() {
 	registerRepository("QCE/CMONGO", NewMongoTcInstanceRepository)
+	registerSnapshotDecoder("QCE/CMONGO", decodeMongoTcInstance)
 }
 
 type MongoTcInstanceRepository struct {
@@ -16,6 +16,7 @@ import (
 
 func init() {
 	registerRepository("TSE/NACOS", NewNaocsTcInstanceRepository)
+	registerSnapshotDecoder("TSE/NACOS", decodeTseTcInstance)
 }
 
 type NacosTcInstanceRepository struct {
@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/NAT_GATEWAY", NewNatTcInstanceRepository)
+	registerSnapshotDecoder("QCE/NAT_GATEWAY", decodeNatTcInstance)
 }
 
 type NatTcInstanceRepository struct {
@@ -17,6 +17,7 @@ var idKey = "db-instance-id"
 
 func init() {
 	registerRepository("QCE/POSTGRES", NewPGTcInstanceRepository)
+	registerSnapshotDecoder("QCE/POSTGRES", decodePGTcInstance)
 }
 
 type PGTcInstanceRepository struct {
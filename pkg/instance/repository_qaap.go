@@ -18,6 +18,7 @@ import (
 
 func init() {
 	registerRepository("QCE/QAAP", NewQaapTcInstanceRepository)
+	registerSnapshotDecoder("QCE/QAAP", decodeQaapTcInstance)
 }
 
 type QaapTcInstanceRepository struct {
@@ -18,7 +18,9 @@ import (
 
 func init() {
 	registerRepository("QCE/REDIS", NewRedisTcInstanceRepository)
+	registerSnapshotDecoder("QCE/REDIS", decodeRedisTcInstance)
 	registerRepository("QCE/REDIS_MEM", NewRedisTcInstanceRepository)
+	registerSnapshotDecoder("QCE/REDIS_MEM", decodeRedisTcInstance)
 }
 
 type RedisTcInstanceRepository struct {
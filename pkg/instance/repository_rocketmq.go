@@ -17,6 +17,7 @@ import (
 
 func init() {
 	registerRepository("QCE/ROCKETMQ", NewRocketMQTcInstanceRepository)
+	registerSnapshotDecoder("QCE/ROCKETMQ", decodeRocketMQTcInstance)
 }
 
 var includeVip = "includeVip"
@@ -14,6 +14,7 @@ import (
 
 func init() {
 	registerRepository("QCE/SQLSERVER", NewSqlServerTcInstanceRepository)
+	registerSnapshotDecoder("QCE/SQLSERVER", decodeSqlServerTcInstance)
 }
 
 type SqlServerTcInstanceRepository struct {
@@ -16,6 +16,7 @@ import (
 
 func init() {
 	registerRepository("QCE/VBC", NewVbcTcInstanceRepository)
+	registerSnapshotDecoder("QCE/VBC", decodeVbcTcInstance)
 }
 
 type VbcTcInstanceRepository struct {
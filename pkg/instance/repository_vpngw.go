@@ -14,6 +14,7 @@ import (
 
 func init() {
 	registerRepository("QCE/VPNGW", NewVpngwTcInstanceRepository)
+	registerSnapshotDecoder("QCE/VPNGW", decodeVpngwTcInstance)
 }
 
 type VpngwTcInstanceRepository struct {
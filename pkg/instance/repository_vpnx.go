@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/VPNX", NewVpnxTcInstanceRepository)
+	registerSnapshotDecoder("QCE/VPNX", decodeVpnxTcInstance)
 }
 
 type VpnxTcInstanceRepository struct {
@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerRepository("QCE/WAF", NewWafTcInstanceRepository)
+	registerSnapshotDecoder("QCE/WAF", decodeWafTcInstance)
 }
 
 type WafTcInstanceRepository struct {
@@ -17,6 +17,7 @@ import (
 
 func init() {
 	registerRepository("TSE/ZOOKEEPER", NewZookeeperTcInstanceRepository)
+	registerSnapshotDecoder("TSE/ZOOKEEPER", decodeTseTcInstance)
 }
 
 type ZookeeperTcInstanceRepository struct {
@@ -0,0 +1,70 @@
+package instance
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"tencentcloud-exporter/pkg/util"
+)
+
+// 实例快照文件内容, 用于重启后不调用云API直接恢复实例缓存
+type instanceSnapshot struct {
+	Namespace string
+	Timestamp int64
+	Instances []*snapshotInstanceItem
+}
+
+type snapshotInstanceItem struct {
+	InstanceId      string
+	MonitorQueryKey string // 恢复时由实例元数据计算, 只用于排查
+	Meta            json.RawMessage
+}
+
+func instanceSnapshotFile(stateDir string, namespace string) string {
+	return filepath.Join(stateDir, fmt.Sprintf("instances_%s.json", util.NamespaceFileName(namespace)))
+}
+
+func saveInstanceSnapshot(stateDir string, namespace string, insList map[string]TcInstance, ts time.Time) error {
+	snapshot := &instanceSnapshot{
+		Namespace: namespace,
+		Timestamp: ts.Unix(),
+	}
+	for _, ins := range insList {
+		meta, err := json.Marshal(ins.GetMeta())
+		if err != nil {
+			return err
+		}
+		snapshot.Instances = append(snapshot.Instances, &snapshotInstanceItem{
+			InstanceId:      ins.GetInstanceId(),
+			MonitorQueryKey: ins.GetMonitorQueryKey(),
+			Meta:            meta,
+		})
+	}
+	return util.WriteJSONFileAtomic(instanceSnapshotFile(stateDir, namespace), snapshot)
+}
+
+func loadInstanceSnapshot(stateDir string, namespace string) (map[string]TcInstance, time.Time, error) {
+	decoder, ok := snapshotDecoderMap[namespace]
+	if !ok {
+		return nil, time.Time{}, fmt.Errorf("instance snapshot not support, namespace=%s", namespace)
+	}
+	snapshot := &instanceSnapshot{}
+	err := util.ReadJSONFile(instanceSnapshotFile(stateDir, namespace), snapshot)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	insList := map[string]TcInstance{}
+	for _, item := range snapshot.Instances {
+		if item.InstanceId == "" {
+			return nil, time.Time{}, fmt.Errorf("instanceId is empty ")
+		}
+		ins, err := decoder(item.InstanceId, item.Meta)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("restore instance %s fail, %s", item.InstanceId, err)
+		}
+		insList[ins.GetInstanceId()] = ins
+	}
+	return insList, time.Unix(snapshot.Timestamp, 0), nil
+}
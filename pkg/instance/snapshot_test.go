@@ -0,0 +1,89 @@
+package instance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	cvm "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cvm/v20170312"
+	tdmq "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/tdmq/v20200217"
+)
+
+func Test_InstanceSnapshotRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	ts := time.Unix(1700000000, 0)
+
+	id, name, ip := "ins-1", "cvm-1", "10.0.0.1"
+	cvmIns, err := NewCvmTcInstance(id, &cvm.Instance{
+		InstanceId:         &id,
+		InstanceName:       &name,
+		PrivateIpAddresses: []*string{&ip},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, saveInstanceSnapshot(dir, "QCE/CVM", map[string]TcInstance{id: cvmIns}, ts))
+
+	insList, restoredTs, err := loadInstanceSnapshot(dir, "QCE/CVM")
+	assert.NoError(t, err)
+	assert.Equal(t, ts, restoredTs)
+	restored, ok := insList[id].(*CvmTcInstance)
+	assert.True(t, ok)
+	meta, ok := restored.GetMeta().(*cvm.Instance)
+	assert.True(t, ok)
+	assert.Equal(t, name, *meta.InstanceName)
+	assert.Equal(t, cvmIns.GetMonitorQueryKey(), restored.GetMonitorQueryKey())
+	val, err := restored.GetFieldValueByName("InstanceName")
+	assert.NoError(t, err)
+	assert.Equal(t, name, val)
+
+	clusterId, clusterName := "rocketmq-1", "cluster-1"
+	mqIns, err := NewRocketMQTcInstance(clusterId, &tdmq.RocketMQClusterDetail{
+		Info: &tdmq.RocketMQClusterInfo{ClusterId: &clusterId, ClusterName: &clusterName},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, saveInstanceSnapshot(dir, "QCE/ROCKETMQ", map[string]TcInstance{clusterId: mqIns}, ts))
+
+	insList, _, err = loadInstanceSnapshot(dir, "QCE/ROCKETMQ")
+	assert.NoError(t, err)
+	mqRestored, ok := insList[clusterId].(*RocketMQTcInstance)
+	assert.True(t, ok)
+	values, err := mqRestored.GetFieldValuesByName("ClusterName")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{clusterName}, values["ClusterName"])
+}
+
+func Test_InstanceSnapshotNotSupport(t *testing.T) {
+	_, _, err := loadInstanceSnapshot(t.TempDir(), "QCE/NOT_EXIST")
+	assert.Error(t, err)
+}
+
+func Test_TcInstanceCacheRestoreKeepSnapshotTime(t *testing.T) {
+	dir := t.TempDir()
+	ts := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	id := "ins-old"
+	ins, err := NewCvmTcInstance(id, &cvm.Instance{InstanceId: &id})
+	assert.NoError(t, err)
+	assert.NoError(t, saveInstanceSnapshot(dir, "QCE/CVM", map[string]TcInstance{id: ins}, ts))
+
+	repo := &changingInstanceRepository{}
+	cache := NewTcInstanceCache("QCE/CVM", repo, time.Hour, dir, log.NewNopLogger()).(*TcInstanceCache)
+	assert.True(t, cache.IsRestored())
+	// 恢复后先使用快照, 不同步reload
+	insList, err := cache.ListByFilters(map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{id}, instanceIds(insList))
+	assert.Equal(t, 0, repo.round)
+
+	// 刷新前写入的快照仍是原来的时间, 不会一直延续
+	assert.NoError(t, cache.Flush())
+	_, restoredTs, err := loadInstanceSnapshot(dir, "QCE/CVM")
+	assert.NoError(t, err)
+	assert.True(t, ts.Equal(restoredTs))
+
+	assert.NoError(t, cache.Refresh())
+	assert.False(t, cache.IsRestored())
+	assert.NoError(t, cache.Flush())
+	_, restoredTs, err = loadInstanceSnapshot(dir, "QCE/CVM")
+	assert.NoError(t, err)
+	assert.True(t, restoredTs.After(ts))
+}
@@ -0,0 +1,138 @@
+package metric
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"tencentcloud-exporter/pkg/config"
+)
+
+// 对一个时间线窗口内的多个数据点做统计, 返回用于导出的数据点
+type Aggregator func(samples *TcmSamples) (*TcmSample, error)
+
+var (
+	aggregatorMap  = make(map[string]Aggregator)
+	aggregatorLock sync.RWMutex
+)
+
+// 注册统计方法, 注册后可以在statistics_types和tc_statistics中使用, handler可以在init中注册产品特有的统计方法
+func RegisterAggregator(name string, aggregator Aggregator) {
+	aggregatorLock.Lock()
+	defer aggregatorLock.Unlock()
+	aggregatorMap[strings.ToLower(name)] = aggregator
+}
+
+func GetAggregator(name string) (Aggregator, bool) {
+	aggregatorLock.RLock()
+	defer aggregatorLock.RUnlock()
+	aggregator, ok := aggregatorMap[strings.ToLower(name)]
+	return aggregator, ok
+}
+
+func init() {
+	RegisterAggregator("last", func(s *TcmSamples) (*TcmSample, error) { return s.GetLatestPoint() })
+	RegisterAggregator("max", func(s *TcmSamples) (*TcmSample, error) { return s.GetMaxPoint() })
+	RegisterAggregator("min", func(s *TcmSamples) (*TcmSample, error) { return s.GetMinPoint() })
+	RegisterAggregator("avg", func(s *TcmSamples) (*TcmSample, error) { return s.GetAvgPoint() })
+	RegisterAggregator("first", func(s *TcmSamples) (*TcmSample, error) { return s.Samples[0], nil })
+	RegisterAggregator("sum", aggregateSum)
+	RegisterAggregator("count", aggregateCount)
+	RegisterAggregator("stddev", aggregateStddev)
+	RegisterAggregator("delta", aggregateDelta)
+	RegisterAggregator("rate", aggregateRate)
+	RegisterAggregator("p50", newPercentileAggregator(0.5))
+	RegisterAggregator("p90", newPercentileAggregator(0.9))
+	RegisterAggregator("p99", newPercentileAggregator(0.99))
+
+	// 加载配置时按已注册的统计方法检查
+	config.IsSupportStatisticsType = func(name string) bool {
+		_, ok := GetAggregator(name)
+		return ok
+	}
+}
+
+// 统计值的时间和纬度使用窗口内最新的数据点
+func newAggregatedSample(s *TcmSamples, value float64) *TcmSample {
+	latest := s.Samples[len(s.Samples)-1]
+	return &TcmSample{
+		Timestamp:  latest.Timestamp,
+		Value:      value,
+		Dimensions: latest.Dimensions,
+	}
+}
+
+func aggregateSum(s *TcmSamples) (*TcmSample, error) {
+	var sum float64
+	for _, sample := range s.Samples {
+		sum += sample.Value
+	}
+	return newAggregatedSample(s, sum), nil
+}
+
+func aggregateCount(s *TcmSamples) (*TcmSample, error) {
+	return newAggregatedSample(s, float64(len(s.Samples))), nil
+}
+
+// 总体标准差
+func aggregateStddev(s *TcmSamples) (*TcmSample, error) {
+	var sum float64
+	for _, sample := range s.Samples {
+		sum += sample.Value
+	}
+	avg := sum / float64(len(s.Samples))
+	var variance float64
+	for _, sample := range s.Samples {
+		variance += (sample.Value - avg) * (sample.Value - avg)
+	}
+	variance = variance / float64(len(s.Samples))
+	return newAggregatedSample(s, math.Sqrt(variance)), nil
+}
+
+// 窗口内最后一个点与第一个点的差值
+func aggregateDelta(s *TcmSamples) (*TcmSample, error) {
+	if len(s.Samples) < 2 {
+		return nil, fmt.Errorf("delta needs at least 2 samples")
+	}
+	first := s.Samples[0]
+	latest := s.Samples[len(s.Samples)-1]
+	return newAggregatedSample(s, latest.Value-first.Value), nil
+}
+
+// 按计数器计算每秒增长率, 数值变小时当作计数器重置
+func aggregateRate(s *TcmSamples) (*TcmSample, error) {
+	if len(s.Samples) < 2 {
+		return nil, fmt.Errorf("rate needs at least 2 samples")
+	}
+	var increase float64
+	for i := 1; i < len(s.Samples); i++ {
+		if s.Samples[i].Value >= s.Samples[i-1].Value {
+			increase += s.Samples[i].Value - s.Samples[i-1].Value
+		} else {
+			increase += s.Samples[i].Value
+		}
+	}
+	duration := s.Samples[len(s.Samples)-1].Timestamp - s.Samples[0].Timestamp
+	if duration <= 0 {
+		return nil, fmt.Errorf("rate needs samples with different timestamps")
+	}
+	return newAggregatedSample(s, increase/duration), nil
+}
+
+// 分位数, 在相邻两个数据点之间线性插值
+func newPercentileAggregator(q float64) Aggregator {
+	return func(s *TcmSamples) (*TcmSample, error) {
+		values := make([]float64, 0, len(s.Samples))
+		for _, sample := range s.Samples {
+			values = append(values, sample.Value)
+		}
+		sort.Float64s(values)
+		rank := q * float64(len(values)-1)
+		lower := int(math.Floor(rank))
+		upper := int(math.Ceil(rank))
+		value := values[lower] + (values[upper]-values[lower])*(rank-float64(lower))
+		return newAggregatedSample(s, value), nil
+	}
+}
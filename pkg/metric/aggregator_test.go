@@ -0,0 +1,93 @@
+package metric
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tencentcloud-exporter/pkg/config"
+	"tencentcloud-exporter/pkg/fakecloud"
+)
+
+func newTestSamples(points ...[2]float64) *TcmSamples {
+	s := &TcmSamples{}
+	for _, p := range points {
+		s.Samples = append(s.Samples, &TcmSample{Timestamp: p[0], Value: p[1]})
+	}
+	return s
+}
+
+func Test_Aggregators(t *testing.T) {
+	values := func(vs ...float64) *TcmSamples {
+		var points [][2]float64
+		for i, v := range vs {
+			points = append(points, [2]float64{float64(i * 60), v})
+		}
+		return newTestSamples(points...)
+	}
+	cases := []struct {
+		name    string
+		stat    string
+		samples *TcmSamples
+		want    float64
+		wantErr bool
+	}{
+		{"stddev", "stddev", values(2, 4, 4, 4, 5, 5, 7, 9), 2, false},
+		{"stddev single", "stddev", values(3), 0, false},
+		{"delta", "delta", values(1, 3, 10), 9, false},
+		{"delta decrease", "delta", values(10, 4), -6, false},
+		{"delta single", "delta", values(1), 0, true},
+		{"rate", "rate", values(0, 60, 120), 1, false},
+		{"rate counter reset", "rate", values(10, 70, 30), 0.75, false},
+		{"rate single", "rate", values(1), 0, true},
+		{"rate same timestamp", "rate", newTestSamples([2]float64{60, 1}, [2]float64{60, 2}), 0, true},
+		{"p50", "p50", values(5, 1, 4, 2, 3), 3, false},
+		{"p90", "p90", values(5, 1, 4, 2, 3), 4.6, false},
+		{"p99", "p99", values(5, 1, 4, 2, 3), 4.96, false},
+		{"p99 single", "p99", values(7), 7, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			aggregator, ok := GetAggregator(c.stat)
+			assert.True(t, ok)
+			point, err := aggregator(c.samples)
+			if c.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.InDelta(t, c.want, point.Value, 1e-9)
+			// 时间使用窗口内最新的数据点
+			assert.Equal(t, c.samples.Samples[len(c.samples.Samples)-1].Timestamp, point.Timestamp)
+		})
+	}
+}
+
+func Test_RegisterAggregator(t *testing.T) {
+	_, ok := GetAggregator("P90")
+	assert.True(t, ok)
+	assert.True(t, config.IsSupportStatisticsType("p90"))
+	assert.False(t, config.IsSupportStatisticsType("p95"))
+
+	// 注册后配置中可以使用, 也可以创建指标
+	RegisterAggregator("P95", newPercentileAggregator(0.95))
+	defer func() {
+		aggregatorLock.Lock()
+		delete(aggregatorMap, "p95")
+		aggregatorLock.Unlock()
+	}()
+	assert.True(t, config.IsSupportStatisticsType("p95"))
+	meta, err := NewTcmMeta(fakecloud.NewMetricSet("QCE/CVM", "CpuUsage", "%", "max", []int64{60}, []string{"InstanceId"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &TcmMetricConfig{CustomNamespacePrefix: "qce", CustomProductName: "cvm", StatPeriodSeconds: 60}
+	conf.StatTypes = []string{"p95"}
+	m, err := NewTcmMetric(meta, conf)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "qce_cvm_cpuusage_p95", m.StatPromDesc["p95"].FQName)
+	}
+	conf.StatTypes = []string{"p75"}
+	_, err = NewTcmMetric(meta, conf)
+	assert.Error(t, err)
+}
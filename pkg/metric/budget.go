@@ -0,0 +1,349 @@
+package metric
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"tencentcloud-exporter/pkg/client"
+	"tencentcloud-exporter/pkg/config"
+)
+
+var (
+	// 预算已用完且配置了stop
+	ErrBudgetExceeded = errors.New("api budget exceeded")
+	// 可选指标被丢弃, 本次不查询
+	ErrBudgetDropped = errors.New("api budget dropped optional metric")
+	// 低优先级产品被降低采集频率, 本次不查询
+	ErrBudgetThrottled = errors.New("api budget throttled")
+)
+
+const (
+	exporterNamespace = "tcm"
+
+	budgetScopeGlobal = "global"
+
+	// 窗口刚开始时调用量很少, 按至少10%的窗口时长估算, 避免误判
+	budgetMinElapsedRatio = 0.1
+	// 按北京时间对齐天窗口
+	budgetDayOffset = 8 * time.Hour
+	// 清理指标上次查询时间的间隔
+	budgetPruneInterval = time.Hour
+)
+
+type budgetState int
+
+const (
+	budgetStateOK budgetState = iota
+	budgetStateDegraded
+	budgetStateExhausted
+)
+
+var budgetStateNames = map[budgetState]string{
+	budgetStateOK:        "ok",
+	budgetStateDegraded:  "degraded",
+	budgetStateExhausted: "exhausted",
+}
+
+var (
+	budgetCallsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(exporterNamespace, "budget", "calls"),
+		"qcloud_exporter: Number of GetMonitorData calls in the current budget window.",
+		[]string{"scope", "window"}, nil,
+	)
+	budgetProjectedCallsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(exporterNamespace, "budget", "projected_calls"),
+		"qcloud_exporter: Projected number of GetMonitorData calls at the end of the current budget window.",
+		[]string{"scope", "window"}, nil,
+	)
+	budgetLimitDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(exporterNamespace, "budget", "limit_calls"),
+		"qcloud_exporter: Max number of GetMonitorData calls allowed in a budget window.",
+		[]string{"scope", "window"}, nil,
+	)
+	budgetStateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(exporterNamespace, "budget", "state"),
+		"qcloud_exporter: Budget state, 0=ok, 1=degraded (projected over budget), 2=exhausted.",
+		[]string{"scope"}, nil,
+	)
+)
+
+// 固定时间窗口内的调用计数
+type budgetWindow struct {
+	name   string
+	length time.Duration
+	offset time.Duration
+	limit  int64
+	start  time.Time
+	used   int64
+}
+
+func (w *budgetWindow) roll(now time.Time) {
+	start := now.Add(w.offset).Truncate(w.length).Add(-w.offset)
+	if !start.Equal(w.start) {
+		w.start = start
+		w.used = 0
+	}
+}
+
+// 按当前窗口内的调用速率估算窗口结束时的调用量
+func (w *budgetWindow) projected(now time.Time) int64 {
+	elapsed := now.Sub(w.start)
+	minElapsed := time.Duration(float64(w.length) * budgetMinElapsedRatio)
+	if elapsed < minElapsed {
+		elapsed = minElapsed
+	}
+	return int64(float64(w.used) * float64(w.length) / float64(elapsed))
+}
+
+func (w *budgetWindow) state(now time.Time) budgetState {
+	if w.limit <= 0 {
+		return budgetStateOK
+	}
+	if w.used >= w.limit {
+		return budgetStateExhausted
+	}
+	if w.projected(now) > w.limit {
+		return budgetStateDegraded
+	}
+	return budgetStateOK
+}
+
+// 一个预算范围(全局或单个产品), 同时有小时和天两个窗口
+type budgetScope struct {
+	name      string
+	windows   []*budgetWindow
+	lastState budgetState
+}
+
+func (s *budgetScope) record(now time.Time) {
+	for _, w := range s.windows {
+		w.roll(now)
+		w.used++
+	}
+}
+
+func (s *budgetScope) state(now time.Time) budgetState {
+	state := budgetStateOK
+	for _, w := range s.windows {
+		w.roll(now)
+		if ws := w.state(now); ws > state {
+			state = ws
+		}
+	}
+	return state
+}
+
+func newBudgetScope(name string, limit config.TencentBudgetLimit) *budgetScope {
+	return &budgetScope{
+		name: name,
+		windows: []*budgetWindow{
+			{name: "hour", length: time.Hour, limit: limit.MaxCallsPerHour},
+			{name: "day", length: 24 * time.Hour, offset: budgetDayOffset, limit: limit.MaxCallsPerDay},
+		},
+	}
+}
+
+// 指标上次被允许查询的时间, 超过降频间隔后等同于没有记录
+type budgetAdmit struct {
+	time     time.Time
+	interval time.Duration
+}
+
+// 云监控GetMonitorData调用预算, 预计超出预算时按配置降级
+type TcmBudget struct {
+	global         *budgetScope
+	products       map[string]*budgetScope
+	degrades       map[string]bool
+	slowdownFactor int64
+	lastAdmits     map[string]*budgetAdmit
+	lastPruneTime  time.Time
+	deniedTotal    *prometheus.CounterVec
+	now            func() time.Time // 测试时替换
+	mu             sync.Mutex
+	logger         log.Logger
+}
+
+// 查询一个指标前检查预算, 返回错误表示本次不查询
+func (b *TcmBudget) Admit(m *TcmMetric) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.pruneAdmits(now)
+	interval := time.Duration(m.Conf.StatPeriodSeconds*b.slowdownFactor) * time.Second
+	scope, state := b.state(m.Meta.Namespace, now)
+	if state == budgetStateOK {
+		b.lastAdmits[m.Id] = &budgetAdmit{time: now, interval: interval}
+		return nil
+	}
+
+	if state == budgetStateExhausted && b.degrades[config.BudgetDegradeStop] {
+		b.deny(scope, config.BudgetDegradeStop, m)
+		return ErrBudgetExceeded
+	}
+	if b.degrades[config.BudgetDegradeDropOptional] && m.Conf.IsOptional {
+		b.deny(scope, config.BudgetDegradeDropOptional, m)
+		return ErrBudgetDropped
+	}
+	if b.degrades[config.BudgetDegradeSlowdown] && m.Conf.IsLowPriority {
+		if last, ok := b.lastAdmits[m.Id]; ok && now.Sub(last.time) < interval {
+			b.deny(scope, config.BudgetDegradeSlowdown, m)
+			return ErrBudgetThrottled
+		}
+	}
+	b.lastAdmits[m.Id] = &budgetAdmit{time: now, interval: interval}
+	return nil
+}
+
+// 超过降频间隔的记录不再影响Admit, 定期清理, 避免已删除的指标一直保留
+func (b *TcmBudget) pruneAdmits(now time.Time) {
+	if now.Sub(b.lastPruneTime) < budgetPruneInterval {
+		return
+	}
+	b.lastPruneTime = now
+	for id, last := range b.lastAdmits {
+		if now.Sub(last.time) >= last.interval {
+			delete(b.lastAdmits, id)
+		}
+	}
+}
+
+// 每次GetMonitorData调用前检查并记录, 一个指标分多批查询时, 预算用完且配置了stop则停止剩余批次
+func (b *TcmBudget) Reserve(m *TcmMetric) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	scope, state := b.state(m.Meta.Namespace, now)
+	if state == budgetStateExhausted && b.degrades[config.BudgetDegradeStop] {
+		b.deny(scope, config.BudgetDegradeStop, m)
+		return ErrBudgetExceeded
+	}
+	b.global.record(now)
+	if scope, ok := b.products[strings.ToLower(m.Meta.Namespace)]; ok {
+		scope.record(now)
+	}
+	return nil
+}
+
+// client重试GetMonitorData时同样计入预算, 预算用完且配置了stop时不再重试
+func (b *TcmBudget) withRetryReserve(ctx context.Context, m *TcmMetric) context.Context {
+	return client.WithRetryHook(ctx, func() bool {
+		return b.Reserve(m) == nil
+	})
+}
+
+// 去掉错误中的ErrBudgetExceeded, 预算用完且配置了stop时不查询不算失败, 状态变化时已打印日志
+func withoutBudgetExceeded(err error) error {
+	if err == ErrBudgetExceeded {
+		return nil
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return err
+	}
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		if e != ErrBudgetExceeded {
+			errs = append(errs, e)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 返回全局和产品预算中更严重的状态
+func (b *TcmBudget) state(namespace string, now time.Time) (string, budgetState) {
+	scope, state := b.global.name, b.checkScope(b.global, now)
+	if ps, ok := b.products[strings.ToLower(namespace)]; ok {
+		if s := b.checkScope(ps, now); s > state {
+			scope, state = ps.name, s
+		}
+	}
+	return scope, state
+}
+
+// 预算状态变化时打印日志, 配置了stop时预算用完的查询不再单独报错
+func (b *TcmBudget) checkScope(scope *budgetScope, now time.Time) budgetState {
+	state := scope.state(now)
+	if state != scope.lastState {
+		level.Warn(b.logger).Log("msg", "Api budget state changed", "scope", scope.name,
+			"from", budgetStateNames[scope.lastState], "to", budgetStateNames[state],
+			"stop_queries", state == budgetStateExhausted && b.degrades[config.BudgetDegradeStop])
+		scope.lastState = state
+	}
+	return state
+}
+
+func (b *TcmBudget) deny(scope string, degrade string, m *TcmMetric) {
+	b.deniedTotal.WithLabelValues(scope, degrade).Inc()
+	level.Debug(b.logger).Log("msg", "Query skipped by api budget", "scope", scope,
+		"degrade", degrade, "metric", m.Meta.MetricName)
+}
+
+func (b *TcmBudget) Describe(ch chan<- *prometheus.Desc) {
+	ch <- budgetCallsDesc
+	ch <- budgetProjectedCallsDesc
+	ch <- budgetLimitDesc
+	ch <- budgetStateDesc
+	b.deniedTotal.Describe(ch)
+}
+
+func (b *TcmBudget) Collect(ch chan<- prometheus.Metric) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	scopes := []*budgetScope{b.global}
+	for _, scope := range b.products {
+		scopes = append(scopes, scope)
+	}
+	for _, scope := range scopes {
+		for _, w := range scope.windows {
+			w.roll(now)
+			ch <- prometheus.MustNewConstMetric(budgetCallsDesc, prometheus.GaugeValue, float64(w.used), scope.name, w.name)
+			ch <- prometheus.MustNewConstMetric(budgetProjectedCallsDesc, prometheus.GaugeValue, float64(w.projected(now)), scope.name, w.name)
+			if w.limit > 0 {
+				ch <- prometheus.MustNewConstMetric(budgetLimitDesc, prometheus.GaugeValue, float64(w.limit), scope.name, w.name)
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(budgetStateDesc, prometheus.GaugeValue, float64(scope.state(now)), scope.name)
+	}
+	b.deniedTotal.Collect(ch)
+}
+
+func NewTcmBudget(conf *config.TencentConfig, logger log.Logger) *TcmBudget {
+	budget := &TcmBudget{
+		global:         newBudgetScope(budgetScopeGlobal, conf.Budget.TencentBudgetLimit),
+		products:       map[string]*budgetScope{},
+		degrades:       map[string]bool{},
+		slowdownFactor: conf.Budget.SlowdownFactor,
+		lastAdmits:     map[string]*budgetAdmit{},
+		deniedTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: exporterNamespace,
+				Subsystem: "budget",
+				Name:      "denied_queries_total",
+				Help:      "qcloud_exporter: Number of metric queries skipped by api budget.",
+			},
+			[]string{"scope", "degrade"},
+		),
+		now:    time.Now,
+		logger: logger,
+	}
+	for _, degrade := range conf.Budget.Degrade {
+		budget.degrades[degrade] = true
+	}
+	for _, pconf := range conf.Products {
+		if pconf.Budget.IsEnabled() {
+			budget.products[strings.ToLower(pconf.Namespace)] = newBudgetScope(pconf.Namespace, pconf.Budget)
+		}
+	}
+	return budget
+}
@@ -0,0 +1,275 @@
+package metric
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"tencentcloud-exporter/pkg/common"
+	"tencentcloud-exporter/pkg/config"
+	"tencentcloud-exporter/pkg/fakecloud"
+)
+
+// 可手动推进的时钟
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestBudget(budget config.TencentBudget) (*TcmBudget, *testClock) {
+	conf := config.NewConfig()
+	conf.Budget = budget
+	b := NewTcmBudget(conf, log.NewNopLogger())
+	// 整点, 北京时间18:00
+	clock := &testClock{now: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}
+	b.now = clock.Now
+	return b, clock
+}
+
+func newTestBudgetMetric(id string, optional bool, lowPriority bool) *TcmMetric {
+	return &TcmMetric{
+		Id:   id,
+		Meta: &TcmMeta{Namespace: "QCE/CVM", MetricName: id},
+		Conf: &TcmMetricConfig{StatPeriodSeconds: 60, IsOptional: optional, IsLowPriority: lowPriority},
+	}
+}
+
+func reserveN(t *testing.T, b *TcmBudget, m *TcmMetric, n int) {
+	for i := 0; i < n; i++ {
+		if err := b.Reserve(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_BudgetWindowRollover(t *testing.T) {
+	b, clock := newTestBudget(config.TencentBudget{
+		TencentBudgetLimit: config.TencentBudgetLimit{MaxCallsPerHour: 10, MaxCallsPerDay: 15},
+		Degrade:            []string{config.BudgetDegradeStop},
+	})
+	m := newTestBudgetMetric("cpu", false, false)
+
+	reserveN(t, b, m, 10)
+	assert.Equal(t, ErrBudgetExceeded, b.Reserve(m))
+	assert.Equal(t, ErrBudgetExceeded, b.Admit(m))
+
+	// 进入下一个小时窗口, 天窗口继续累计
+	clock.Add(time.Hour)
+	assert.NoError(t, b.Admit(m))
+	reserveN(t, b, m, 5)
+	assert.Equal(t, int64(5), b.global.windows[0].used)
+	assert.Equal(t, int64(15), b.global.windows[1].used)
+	assert.Equal(t, ErrBudgetExceeded, b.Reserve(m))
+
+	// 天窗口按北京时间0点(UTC 16:00)切换
+	clock.now = time.Date(2024, 1, 1, 15, 59, 0, 0, time.UTC)
+	assert.Equal(t, ErrBudgetExceeded, b.Reserve(m))
+	clock.now = time.Date(2024, 1, 1, 16, 0, 0, 0, time.UTC)
+	assert.NoError(t, b.Reserve(m))
+	assert.Equal(t, int64(1), b.global.windows[1].used)
+}
+
+func Test_BudgetProjection(t *testing.T) {
+	b, clock := newTestBudget(config.TencentBudget{
+		TencentBudgetLimit: config.TencentBudgetLimit{MaxCallsPerHour: 100},
+	})
+	m := newTestBudgetMetric("cpu", false, false)
+	w := b.global.windows[0]
+
+	// 窗口开始1分钟, 按6分钟(10%)估算: 5×60/6=50
+	clock.Add(time.Minute)
+	reserveN(t, b, m, 5)
+	assert.Equal(t, int64(50), w.projected(clock.Now()))
+	assert.Equal(t, budgetStateOK, b.global.state(clock.Now()))
+
+	// 窗口开始12分钟: 30×60/12=150
+	clock.Add(11 * time.Minute)
+	reserveN(t, b, m, 25)
+	assert.Equal(t, int64(150), w.projected(clock.Now()))
+	assert.Equal(t, budgetStateDegraded, b.global.state(clock.Now()))
+
+	// 调用速率下降后恢复
+	clock.Add(18 * time.Minute)
+	assert.Equal(t, int64(60), w.projected(clock.Now()))
+	assert.Equal(t, budgetStateOK, b.global.state(clock.Now()))
+}
+
+func Test_BudgetDegrade(t *testing.T) {
+	limit := config.TencentBudgetLimit{MaxCallsPerHour: 100}
+	// 窗口开始10分钟时已调用50次, 预计300次, 超出预算但没有用完
+	degraded := func(degrade ...string) (*TcmBudget, *testClock) {
+		b, clock := newTestBudget(config.TencentBudget{TencentBudgetLimit: limit, Degrade: degrade, SlowdownFactor: 2})
+		clock.Add(10 * time.Minute)
+		reserveN(t, b, newTestBudgetMetric("other", false, false), 50)
+		return b, clock
+	}
+
+	t.Run("stop", func(t *testing.T) {
+		b, _ := degraded(config.BudgetDegradeStop)
+		// 只有预算用完才停止
+		assert.NoError(t, b.Admit(newTestBudgetMetric("cpu", true, true)))
+		assert.NoError(t, b.Reserve(newTestBudgetMetric("cpu", true, true)))
+	})
+
+	t.Run("drop_optional", func(t *testing.T) {
+		b, _ := degraded(config.BudgetDegradeDropOptional)
+		assert.Equal(t, ErrBudgetDropped, b.Admit(newTestBudgetMetric("optional", true, false)))
+		assert.NoError(t, b.Admit(newTestBudgetMetric("required", false, false)))
+	})
+
+	t.Run("slowdown", func(t *testing.T) {
+		b, clock := degraded(config.BudgetDegradeSlowdown)
+		low := newTestBudgetMetric("low", false, true)
+		normal := newTestBudgetMetric("normal", false, false)
+		// 低优先级按2倍周期查询
+		assert.NoError(t, b.Admit(low))
+		clock.Add(time.Minute)
+		assert.Equal(t, ErrBudgetThrottled, b.Admit(low))
+		assert.NoError(t, b.Admit(normal))
+		clock.Add(time.Minute)
+		assert.NoError(t, b.Admit(low))
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		b, _ := degraded(config.BudgetDegradeStop, config.BudgetDegradeDropOptional)
+		reserveN(t, b, newTestBudgetMetric("other", false, false), 50)
+		assert.Equal(t, ErrBudgetExceeded, b.Admit(newTestBudgetMetric("optional", true, false)))
+	})
+}
+
+func Test_BudgetPruneAdmits(t *testing.T) {
+	b, clock := newTestBudget(config.TencentBudget{SlowdownFactor: 2})
+	assert.NoError(t, b.Admit(newTestBudgetMetric("removed", false, true)))
+	assert.Len(t, b.lastAdmits, 1)
+
+	// 超过降频间隔且到了清理时间后, 不再查询的指标被清理
+	clock.Add(budgetPruneInterval)
+	assert.NoError(t, b.Admit(newTestBudgetMetric("cpu", false, true)))
+	assert.Len(t, b.lastAdmits, 1)
+	_, ok := b.lastAdmits["cpu"]
+	assert.True(t, ok)
+}
+
+// 创建CpuUsage指标, 每个实例一个时间线
+func newTestBudgetQueryMetric(t *testing.T, conf *config.TencentConfig, repo TcmMetricRepository, ids ...string) *TcmMetric {
+	meta, err := repo.GetMeta("QCE/CVM", "CpuUsage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pconf, err := conf.GetProductConfig("QCE/CVM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mconf, err := NewTcmMetricConfigWithProductYaml(pconf, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewTcmMetric(meta, mconf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var series []*TcmSeries
+	for _, id := range ids {
+		s, err := NewTcmSeries(m, Labels{"InstanceId": id}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		series = append(series, s)
+	}
+	if err := m.LoadSeries(series); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func Test_BudgetStopRemainingBatches(t *testing.T) {
+	s := fakecloud.NewServer("AKID", "secret")
+	defer s.Close()
+	s.AddMetric(fakecloud.NewMetricSet("QCE/CVM", "CpuUsage", "%", "max", []int64{60, 300}, []string{"InstanceId"}))
+	s.SetMetricValues("QCE/CVM", "CpuUsage", func(dimensions map[string]string, ts int64) (float64, bool) {
+		return 1, true
+	})
+
+	conf := newFakeCloudConfig(t, s)
+	// 6个实例分3批查询, 预算只够2批
+	conf.Budget = config.TencentBudget{
+		TencentBudgetLimit: config.TencentBudgetLimit{MaxCallsPerHour: 2},
+		Degrade:            []string{config.BudgetDegradeStop},
+	}
+	cred := &common.Credential{SecretId: conf.Credential.AccessKey, SecretKey: conf.Credential.SecretKey}
+	repo, err := NewTcmMetricRepository(cred, conf, NewTcmBudget(conf, log.NewNopLogger()), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestBudgetQueryMetric(t, conf, repo, "ins-1", "ins-2", "ins-3", "ins-4", "ins-5", "ins-6")
+
+	now := time.Now().Unix()
+	samplesList, err := repo.ListSamples(context.Background(), m, now-300, now)
+	assert.True(t, errors.Is(err, ErrBudgetExceeded))
+	assert.Len(t, samplesList, 4)
+	assert.Len(t, s.Requests("monitor", "GetMonitorData"), 2)
+
+	// 预算用完后整个指标不再查询
+	_, err = repo.ListSamples(context.Background(), m, now-300, now)
+	assert.Equal(t, ErrBudgetExceeded, err)
+	assert.Len(t, s.Requests("monitor", "GetMonitorData"), 2)
+
+	// 停止查询不算失败
+	q, err := NewTcmQuery(m, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pms, err := q.GetPromMetrics(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, pms)
+}
+
+func Test_BudgetCountRetries(t *testing.T) {
+	s := fakecloud.NewServer("AKID", "secret")
+	defer s.Close()
+	s.AddMetric(fakecloud.NewMetricSet("QCE/CVM", "CpuUsage", "%", "max", []int64{60, 300}, []string{"InstanceId"}))
+	s.SetMetricValues("QCE/CVM", "CpuUsage", func(dimensions map[string]string, ts int64) (float64, bool) {
+		return 1, true
+	})
+
+	conf := newFakeCloudConfig(t, s)
+	conf.Budget = config.TencentBudget{
+		TencentBudgetLimit: config.TencentBudgetLimit{MaxCallsPerHour: 4},
+		Degrade:            []string{config.BudgetDegradeStop},
+	}
+	cred := &common.Credential{SecretId: conf.Credential.AccessKey, SecretKey: conf.Credential.SecretKey}
+	budget := NewTcmBudget(conf, log.NewNopLogger())
+	repo, err := NewTcmMetricRepository(cred, conf, budget, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestBudgetQueryMetric(t, conf, repo, "ins-1", "ins-2")
+
+	// 重试2次后成功, 每次重试都计入预算
+	s.InjectFault("monitor", "GetMonitorData", fakecloud.Fault{Error: fakecloud.NewError("InternalError", "retry"), Times: 2})
+	now := time.Now().Unix()
+	samplesList, err := repo.ListSamples(context.Background(), m, now-300, now)
+	assert.NoError(t, err)
+	assert.Len(t, samplesList, 2)
+	assert.Len(t, s.Requests("monitor", "GetMonitorData"), 3)
+	assert.Equal(t, int64(3), budget.global.windows[0].used)
+
+	// 预算用完后不再重试
+	s.InjectFault("monitor", "GetMonitorData", fakecloud.Fault{Error: fakecloud.NewError("InternalError", "retry"), Times: 3})
+	_, err = repo.ListSamples(context.Background(), m, now-300, now)
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrBudgetExceeded))
+	assert.Len(t, s.Requests("monitor", "GetMonitorData"), 4)
+	assert.Equal(t, int64(4), budget.global.windows[0].used)
+}
@@ -1,20 +1,50 @@
 package metric
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 )
 
+const metaChangeBufferSize = 16
+
+// 指标元数据变更事件, 统计周期等元数据变化的指标同时出现在Added和Removed中
+type TcmMetaChange struct {
+	Namespace string
+	Added     []*TcmMeta
+	Removed   []*TcmMeta
+}
+
+func (c *TcmMetaChange) IsEmpty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0
+}
+
+// 支持指标元数据变更通知的TcmMetricRepository
+type TcmMetaChangeNotifier interface {
+	// 某个namespace的元数据变更事件流, 每次刷新发现变更时推送一次
+	MetaChanges(namespace string) <-chan *TcmMetaChange
+}
+
 // 腾讯云监控指标缓存, 在TcmMetricRepository封装一层, 指标元数据使用缓存, 转发获取数据点请求
 type TcmMetricCache struct {
 	Raw                TcmMetricRepository
 	metaCache          map[string]map[string]*TcmMeta //k1=namespace, k2=metricname(小写)
 	metaLastReloadTime map[string]int64
+	metaTTL            time.Duration
+	refreshing         map[string]bool // 正在后台刷新的namespace
+	refreshWg          sync.WaitGroup  // 后台刷新, Flush前等待完成
+	changes            map[string]chan *TcmMetaChange
+	stateDir           string // 为空时不使用快照
 	logger             log.Logger
+	mu                 sync.RWMutex
+	loadMu             sync.Mutex // 保证同一时间只有一个namespace在首次加载
 }
 
 func (c *TcmMetricCache) GetMeta(namespace string, name string) (*TcmMeta, error) {
@@ -22,6 +52,8 @@ func (c *TcmMetricCache) GetMeta(namespace string, name string) (*TcmMeta, error
 	if err != nil {
 		return nil, err
 	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	np, exists := c.metaCache[namespace]
 	if !exists {
 		return nil, fmt.Errorf("namespace cache not exists")
@@ -38,6 +70,8 @@ func (c *TcmMetricCache) ListMetaByNamespace(namespace string) ([]*TcmMeta, erro
 	if err != nil {
 		return nil, err
 	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	var metas []*TcmMeta
 	for _, meta := range c.metaCache[namespace] {
 		metas = append(metas, meta)
@@ -45,43 +79,244 @@ func (c *TcmMetricCache) ListMetaByNamespace(namespace string) ([]*TcmMeta, erro
 	return metas, nil
 }
 
-func (c *TcmMetricCache) GetSamples(series *TcmSeries, startTime int64, endTime int64) (samples *TcmSamples, err error) {
-	return c.Raw.GetSamples(series, startTime, endTime)
+func (c *TcmMetricCache) GetSamples(ctx context.Context, series *TcmSeries, startTime int64, endTime int64) (samples *TcmSamples, err error) {
+	return c.Raw.GetSamples(ctx, series, startTime, endTime)
 }
 
-func (c *TcmMetricCache) ListSamples(metric *TcmMetric, startTime int64, endTime int64) (samplesList []*TcmSamples, err error) {
-	return c.Raw.ListSamples(metric, startTime, endTime)
+func (c *TcmMetricCache) ListSamples(ctx context.Context, metric *TcmMetric, startTime int64, endTime int64) (samplesList []*TcmSamples, err error) {
+	return c.Raw.ListSamples(ctx, metric, startTime, endTime)
 }
 
-// 检测是否需要reload缓存的数据
+func (c *TcmMetricCache) MetaChanges(namespace string) <-chan *TcmMetaChange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch, ok := c.changes[namespace]
+	if !ok {
+		ch = make(chan *TcmMetaChange, metaChangeBufferSize)
+		c.changes[namespace] = ch
+	}
+	return ch
+}
+
+// 检测是否需要reload缓存的数据, 已加载但超过TTL时返回旧数据并在后台刷新
 func (c *TcmMetricCache) checkMetaNeedreload(namespace string) (err error) {
-	v, ok := c.metaLastReloadTime[namespace]
-	if ok && v != 0 {
+	if c.isLoaded(namespace) {
+		c.refreshIfExpired(namespace)
+		return nil
+	}
+
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+	if c.isLoaded(namespace) {
 		return nil
 	}
+
+	// 快照过期时同样走后台刷新
+	if c.restoreSnapshot(namespace) {
+		c.refreshIfExpired(namespace)
+		return nil
+	}
+	return c.reload(namespace)
+}
+
+func (c *TcmMetricCache) isLoaded(namespace string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.metaLastReloadTime[namespace]
+	return ok && v != 0
+}
+
+func (c *TcmMetricCache) refreshIfExpired(namespace string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refreshing[namespace] {
+		return
+	}
+	if time.Since(time.Unix(c.metaLastReloadTime[namespace], 0)) < c.metaTTL {
+		return
+	}
+	c.refreshing[namespace] = true
+	c.refreshWg.Add(1)
+	go func() {
+		defer c.refreshWg.Done()
+		c.refresh(namespace)
+	}()
+}
+
+// 按metaTTL定时刷新已加载的namespace, 不依赖GetMeta/ListMetaByNamespace的调用频率, ctx取消后退出
+func (c *TcmMetricCache) RefreshMetaPeriodically(ctx context.Context, namespace string) {
+	if c.metaTTL <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.metaTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		c.mu.Lock()
+		// 未加载的namespace在首次使用时加载
+		if c.refreshing[namespace] || c.metaLastReloadTime[namespace] == 0 {
+			c.mu.Unlock()
+			continue
+		}
+		c.refreshing[namespace] = true
+		c.mu.Unlock()
+		c.refresh(namespace)
+	}
+}
+
+// 调用前需设置refreshing, 刷新完成后清除
+func (c *TcmMetricCache) refresh(namespace string) {
+	if e := c.reload(namespace); e != nil {
+		level.Error(c.logger).Log("msg", "Refresh metric meta cache fail", "namespace", namespace, "err", e)
+	}
+	c.mu.Lock()
+	delete(c.refreshing, namespace)
+	c.mu.Unlock()
+}
+
+func (c *TcmMetricCache) reload(namespace string) error {
 	metas, err := c.Raw.ListMetaByNamespace(namespace)
 	if err != nil {
 		return err
 	}
-	np, ok := c.metaCache[namespace]
-	if !ok {
-		np = map[string]*TcmMeta{}
-		c.metaCache[namespace] = np
+	now := time.Now()
+	change := c.swap(namespace, metas, now)
+	if !change.IsEmpty() {
+		level.Info(c.logger).Log("msg", "Metric meta changed", "namespace", namespace,
+			"added", strings.Join(metaNames(change.Added), ","),
+			"removed", strings.Join(metaNames(change.Removed), ","))
+		c.notify(change)
 	}
+	if c.stateDir != "" {
+		if e := saveMetaSnapshot(c.stateDir, namespace, metas, now); e != nil {
+			level.Warn(c.logger).Log("msg", "Save metric meta snapshot fail", "namespace", namespace, "err", e)
+		}
+	}
+
+	level.Info(c.logger).Log("msg", "Reload metric meta cache", "namespace", namespace, "num", len(metas))
+	return nil
+}
+
+// 用新的元数据整体替换该namespace的缓存, 返回与旧数据的差异, 首次加载不算变更
+func (c *TcmMetricCache) swap(namespace string, metas []*TcmMeta, ts time.Time) *TcmMetaChange {
+	np := map[string]*TcmMeta{}
 	for _, meta := range metas {
 		np[strings.ToLower(meta.MetricName)] = meta
 	}
-	c.metaLastReloadTime[namespace] = time.Now().Unix()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	change := &TcmMetaChange{Namespace: namespace}
+	if old, ok := c.metaCache[namespace]; ok {
+		change = diffMetas(namespace, old, np)
+	}
+	c.metaCache[namespace] = np
+	c.metaLastReloadTime[namespace] = ts.Unix()
+	return change
+}
+
+func (c *TcmMetricCache) notify(change *TcmMetaChange) {
+	c.mu.RLock()
+	ch, ok := c.changes[change.Namespace]
+	c.mu.RUnlock()
+	if !ok {
+		return
+	}
+	select {
+	case ch <- change:
+	default:
+		level.Warn(c.logger).Log("msg", "Metric meta change stream is full, drop change event",
+			"namespace", change.Namespace)
+	}
+}
+
+func diffMetas(namespace string, oldMetas map[string]*TcmMeta, newMetas map[string]*TcmMeta) *TcmMetaChange {
+	change := &TcmMetaChange{Namespace: namespace}
+	for name, meta := range newMetas {
+		old, ok := oldMetas[name]
+		if !ok {
+			change.Added = append(change.Added, meta)
+		} else if !old.IsSamePeriods(meta) {
+			change.Removed = append(change.Removed, old)
+			change.Added = append(change.Added, meta)
+		}
+	}
+	for name, meta := range oldMetas {
+		if _, ok := newMetas[name]; !ok {
+			change.Removed = append(change.Removed, meta)
+		}
+	}
+	return change
+}
+
+func metaNames(metas []*TcmMeta) []string {
+	var names []string
+	for _, meta := range metas {
+		names = append(names, meta.MetricName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 退出前将所有namespace的元数据缓存写入快照
+func (c *TcmMetricCache) Flush() error {
+	if c.stateDir == "" {
+		return nil
+	}
+	// 等待后台刷新完成, 写入刷新后的元数据
+	c.refreshWg.Wait()
+	c.mu.RLock()
+	snapshots := map[string][]*TcmMeta{}
+	for namespace, np := range c.metaCache {
+		for _, meta := range np {
+			snapshots[namespace] = append(snapshots[namespace], meta)
+		}
+	}
+	reloadTimes := map[string]int64{}
+	for namespace, ts := range c.metaLastReloadTime {
+		reloadTimes[namespace] = ts
+	}
+	c.mu.RUnlock()
+
+	var err error
+	for namespace, metas := range snapshots {
+		if e := saveMetaSnapshot(c.stateDir, namespace, metas, time.Unix(reloadTimes[namespace], 0)); e != nil {
+			level.Warn(c.logger).Log("msg", "Save metric meta snapshot fail", "namespace", namespace, "err", e)
+			err = e
+		}
+	}
+	return err
+}
 
-	level.Info(c.logger).Log("msg", "Reload metric meta cache", "namespace", namespace, "num", len(np))
-	return
+func (c *TcmMetricCache) restoreSnapshot(namespace string) bool {
+	if c.stateDir == "" {
+		return false
+	}
+	metas, ts, err := loadMetaSnapshot(c.stateDir, namespace)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			level.Warn(c.logger).Log("msg", "Load metric meta snapshot fail", "namespace", namespace, "err", err)
+		}
+		return false
+	}
+	c.swap(namespace, metas, ts)
+	level.Info(c.logger).Log("msg", "Restore metric meta cache from snapshot", "namespace", namespace,
+		"num", len(metas), "snapshot_time", ts.Format(time.RFC3339))
+	return true
 }
 
-func NewTcmMetricCache(repo TcmMetricRepository, logger log.Logger) TcmMetricRepository {
+func NewTcmMetricCache(repo TcmMetricRepository, metaTTL time.Duration, stateDir string, logger log.Logger) TcmMetricRepository {
 	cache := &TcmMetricCache{
 		Raw:                repo,
 		metaCache:          map[string]map[string]*TcmMeta{},
 		metaLastReloadTime: map[string]int64{},
+		metaTTL:            metaTTL,
+		refreshing:         map[string]bool{},
+		changes:            map[string]chan *TcmMetaChange{},
+		stateDir:           stateDir,
 		logger:             logger,
 	}
 	return cache
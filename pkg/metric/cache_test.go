@@ -0,0 +1,67 @@
+package metric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"tencentcloud-exporter/pkg/fakecloud"
+)
+
+// 首次返回CpuUsage, 之后等待release后返回CpuUsage和MemUsage
+type slowMetaRepository struct {
+	TcmMetricRepository
+	calls   int
+	release chan struct{}
+}
+
+func (r *slowMetaRepository) ListMetaByNamespace(namespace string) ([]*TcmMeta, error) {
+	r.calls++
+	names := []string{"CpuUsage"}
+	if r.calls > 1 {
+		<-r.release
+		names = append(names, "MemUsage")
+	}
+	var metas []*TcmMeta
+	for _, name := range names {
+		meta, err := NewTcmMeta(fakecloud.NewMetricSet(namespace, name, "%", "max", []int64{60}, []string{"InstanceId"}))
+		if err != nil {
+			return nil, err
+		}
+		metas = append(metas, meta)
+	}
+	return metas, nil
+}
+
+func Test_TcmMetricCacheFlushWaitRefresh(t *testing.T) {
+	dir := t.TempDir()
+	repo := &slowMetaRepository{release: make(chan struct{})}
+	cache := NewTcmMetricCache(repo, time.Nanosecond, dir, log.NewNopLogger())
+
+	metas, err := cache.ListMetaByNamespace("QCE/CVM")
+	assert.NoError(t, err)
+	assert.Len(t, metas, 1)
+	// 元数据过期, 后台刷新, 先返回旧的元数据
+	metas, err = cache.ListMetaByNamespace("QCE/CVM")
+	assert.NoError(t, err)
+	assert.Len(t, metas, 1)
+
+	done := make(chan error)
+	go func() {
+		done <- cache.(*TcmMetricCache).Flush()
+	}()
+	select {
+	case <-done:
+		t.Fatal("flush before refresh done")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(repo.release)
+	assert.NoError(t, <-done)
+
+	// 快照是刷新后的元数据
+	metas, _, err = loadMetaSnapshot(dir, "QCE/CVM")
+	assert.NoError(t, err)
+	assert.Len(t, metas, 2)
+}
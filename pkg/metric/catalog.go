@@ -0,0 +1,53 @@
+package metric
+
+import (
+	"sort"
+
+	"tencentcloud-exporter/pkg/config"
+)
+
+// 指标目录, 描述一个云监控指标及其导出的Prometheus指标, 用于生成文档
+type TcmMetricCatalogItem struct {
+	Namespace  string                `json:"namespace"`
+	MetricName string                `json:"metric_name"`
+	Unit       string                `json:"unit"`
+	MeaningEn  string                `json:"meaning_en"`
+	MeaningZh  string                `json:"meaning_zh"`
+	Dimensions []string              `json:"dimensions"`
+	Periods    []int64               `json:"periods"`
+	Period     int64                 `json:"period"` // 实际使用的统计周期
+	Labels     []string              `json:"labels"`
+	Metrics    []*TcmCatalogPromDesc `json:"metrics"`
+}
+
+// 按统计方法导出的Prometheus指标
+type TcmCatalogPromDesc struct {
+	Name      string `json:"name"`
+	Statistic string `json:"statistic"`
+	Help      string `json:"help"`
+}
+
+func (m *TcmMetric) GetCatalogItem() *TcmMetricCatalogItem {
+	item := &TcmMetricCatalogItem{
+		Namespace:  m.Meta.Namespace,
+		MetricName: m.Meta.MetricName,
+		Unit:       m.Meta.GetUnit(),
+		MeaningEn:  m.Meta.GetMeaning(config.HelpLanguageEn),
+		MeaningZh:  m.Meta.GetMeaning(config.HelpLanguageZh),
+		Dimensions: m.Meta.GetDimensions(),
+		Periods:    m.Meta.GetPeriods(),
+		Period:     m.Conf.StatPeriodSeconds,
+		Labels:     m.Labels.Names,
+	}
+	for st, desc := range m.StatPromDesc {
+		item.Metrics = append(item.Metrics, &TcmCatalogPromDesc{
+			Name:      desc.FQName,
+			Statistic: st,
+			Help:      desc.Help,
+		})
+	}
+	sort.Slice(item.Metrics, func(i, j int) bool {
+		return item.Metrics[i].Name < item.Metrics[j].Name
+	})
+	return item
+}
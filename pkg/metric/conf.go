@@ -2,6 +2,7 @@ package metric
 
 import (
 	"strings"
+	"time"
 
 	"tencentcloud-exporter/pkg/config"
 )
@@ -22,6 +23,16 @@ type TcmMetricConfig struct {
 	InstanceFilters       map[string]string
 	OnlyIncludeInstances  []string
 	ExcludeInstances      []string
+	NamingScheme          string
+	HelpLanguage          string
+	NameTemplate          string
+	RelabelConfigs        []*config.RelabelConfig // 产品和全局的metric_relabel_configs
+	IsLowPriority         bool                    // 预计超出预算时降低采集频率
+	IsOptional            bool                    // 预计超出预算时不再采集
+	NodataThreshold       int                     // 连续多少次查询没有数据点时认为时间线没有数据
+	SkipNodataSeries      bool                    // 不再查询没有数据的时间线, 直到下次重新加载实例
+	OnMissingData         string                  // 时间线本次没有数据时的处理方式, 为空时不导出
+	MissingDataTTL        time.Duration           // last_known导出上次值的有效期
 }
 
 func (c *TcmMetricConfig) IsIncludeOnlyInstance() bool {
@@ -86,6 +97,8 @@ func NewTcmMetricConfigWithMetricYaml(c config.TencentMetric, meta *TcmMeta) (*T
 	}
 
 	conf.InstanceFilters = c.Filters
+	conf.NamingScheme = c.NamingScheme
+	conf.NameTemplate = c.NameTemplate
 	return conf, nil
 
 }
@@ -128,6 +141,20 @@ func NewTcmMetricConfigWithProductYaml(c config.TencentProduct, meta *TcmMeta) (
 	conf.InstanceFilters = c.InstanceFilters
 	conf.OnlyIncludeInstances = c.OnlyIncludeInstances
 	conf.ExcludeInstances = c.ExcludeInstances
+	conf.NamingScheme = c.NamingScheme
+	conf.NameTemplate = c.NameTemplate
+	conf.IsLowPriority = c.Priority == config.ProductPriorityLow
+	conf.NodataThreshold = c.NodataThreshold
+	conf.SkipNodataSeries = c.SkipNodataSeries
+	conf.OnMissingData, conf.MissingDataTTL, err = c.GetOnMissingData()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range c.OptionalMetrics {
+		if strings.EqualFold(name, meta.MetricName) {
+			conf.IsOptional = true
+		}
+	}
 
 	return conf, nil
 
@@ -47,6 +47,23 @@ func (meta *TcmMeta) GetPeriod(confPeriod int64) (int64, error) {
 	return int64(allowPeriods[idx]), nil
 }
 
+// 支持的统计周期是否一致, 用于判断元数据刷新后指标是否需要重建
+func (meta *TcmMeta) IsSamePeriods(other *TcmMeta) bool {
+	if len(meta.m.Period) != len(other.m.Period) {
+		return false
+	}
+	periods := map[int64]struct{}{}
+	for _, p := range meta.m.Period {
+		periods[*p] = struct{}{}
+	}
+	for _, p := range other.m.Period {
+		if _, ok := periods[*p]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
 func (meta *TcmMeta) GetStatType(period int64) (string, error) {
 	var statType string
 	var defaultStatType string
@@ -73,6 +90,63 @@ func (meta *TcmMeta) GetStatType(period int64) (string, error) {
 
 }
 
+func (meta *TcmMeta) GetUnit() string {
+	if meta.m.Unit == nil {
+		return ""
+	}
+	return *meta.m.Unit
+}
+
+// 指标含义, 没有英文说明时使用中文
+func (meta *TcmMeta) GetMeaning(language string) string {
+	var en, zh string
+	if meta.m.Meaning != nil {
+		if meta.m.Meaning.En != nil {
+			en = *meta.m.Meaning.En
+		}
+		if meta.m.Meaning.Zh != nil {
+			zh = *meta.m.Meaning.Zh
+		}
+	}
+	switch language {
+	case config.HelpLanguageEn:
+		if en != "" {
+			return en
+		}
+		return zh
+	case config.HelpLanguageBoth:
+		if en == "" || en == zh {
+			return zh
+		}
+		return en + " / " + zh
+	}
+	return zh
+}
+
+// 支持的统计周期, 升序
+func (meta *TcmMeta) GetPeriods() []int64 {
+	var periods []int64
+	for _, p := range meta.m.Period {
+		periods = append(periods, *p)
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i] < periods[j] })
+	return periods
+}
+
+// 支持的纬度, 去重后排序
+func (meta *TcmMeta) GetDimensions() []string {
+	var dimensions []string
+	exists := map[string]bool{}
+	for _, d := range meta.SupportDimensions {
+		if !exists[d] {
+			exists[d] = true
+			dimensions = append(dimensions, d)
+		}
+	}
+	sort.Strings(dimensions)
+	return dimensions
+}
+
 func NewTcmMeta(m *monitor.MetricSet) (*TcmMeta, error) {
 	id := fmt.Sprintf("%s-%s", *m.Namespace, *m.MetricName)
 
@@ -1,13 +1,19 @@
 package metric
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
 
+	"tencentcloud-exporter/pkg/config"
 	"tencentcloud-exporter/pkg/util"
 )
 
@@ -15,6 +21,8 @@ type SeriesCache struct {
 	Series map[string]*TcmSeries // 包含的多个时间线
 	// need cache it, because some cases DescribeBaseMetrics/GetMonitorData dims not match
 	LabelNames map[string]struct{}
+	// 导出的标签名, 按名称排序, LoadSeries时确定, 同一个指标的所有时间线使用相同的标签集合
+	PromLabelNames []string
 }
 
 func newCache() *SeriesCache {
@@ -25,19 +33,28 @@ func newCache() *SeriesCache {
 }
 
 type Desc struct {
-	FQName string
-	Help   string
+	FQName    string
+	Help      string
+	Scale     float64              // 导出值=原始值×Scale, 用于单位转换
+	ValueType prometheus.ValueType // 云监控返回的是按统计周期聚合的值, 默认gauge
 }
 
 // 代表一个指标, 包含多个时间线
 type TcmMetric struct {
-	Id           string
-	Meta         *TcmMeta   // 指标元数据
-	Labels       *TcmLabels // 指标labels
-	SeriesCache  *SeriesCache
-	StatPromDesc map[string]Desc // 按统计纬度的Desc, max、min、avg、last
-	Conf         *TcmMetricConfig
-	seriesLock   sync.Mutex
+	Id             string
+	Meta           *TcmMeta   // 指标元数据
+	Labels         *TcmLabels // 指标labels
+	SeriesCache    *SeriesCache
+	StatPromDesc   map[string]Desc // 按统计纬度的Desc, max、min、avg、last
+	Conf           *TcmMetricConfig
+	seriesLock     sync.Mutex
+	promDescs      map[string]*prometheus.Desc // 按指标名和标签名缓存的Desc, 只保留最近一次查询用到的
+	descLock       sync.Mutex
+	nodataCache    *SeriesCache   // nodataCounts对应的时间线缓存
+	nodataCounts   map[string]int // 每个时间线连续没有数据点的查询次数
+	nodataLock     sync.Mutex
+	lastValues     map[string]*lastValue // 按指标名和标签缓存的上次导出的值, 用于on_missing_data
+	lastValuesLock sync.Mutex
 }
 
 func (m *TcmMetric) LoadSeries(series []*TcmSeries) error {
@@ -53,11 +70,58 @@ func (m *TcmMetric) LoadSeries(series []*TcmSeries) error {
 			newSeriesCache.LabelNames[key] = struct{}{}
 		}
 	}
+	newSeriesCache.PromLabelNames = m.promLabelNames(newSeriesCache)
 	m.SeriesCache = newSeriesCache
 	return nil
 }
 
-func (m *TcmMetric) GetLatestPromMetrics(repo TcmMetricRepository) (pms []prometheus.Metric, err error) {
+// 指标的查询标签、常量标签、时间线的查询维度和实例实际产生的标签, 经过relabel后得到导出的标签名
+// 实例标签按实例取值, 如Tags展开为每个标签键
+func (m *TcmMetric) promLabelNames(cache *SeriesCache) []string {
+	names := map[string]struct{}{}
+	for _, name := range m.Labels.queryLableNames {
+		names[util.ToUnderlineLower(name)] = struct{}{}
+	}
+	for name := range m.Labels.constLabels {
+		names[util.ToUnderlineLower(name)] = struct{}{}
+	}
+	for name := range cache.LabelNames {
+		names[util.ToUnderlineLower(name)] = struct{}{}
+	}
+	for _, s := range cache.Series {
+		for name := range m.Labels.GetValues(s.QueryLabels, s.Instance) {
+			names[util.ToUnderlineLower(name)] = struct{}{}
+		}
+	}
+	if m.Conf != nil && len(m.Conf.RelabelConfigs) != 0 {
+		names = relabelLabelNames(names, m.Conf.RelabelConfigs)
+	}
+	var sorted []string
+	for name := range names {
+		// __开头的标签只在relabel中使用
+		if strings.HasPrefix(name, model.ReservedLabelPrefix) || !model.LabelName(name).IsValid() {
+			continue
+		}
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// 当前的时间线缓存, LoadSeries时整体替换, 返回的缓存不会再修改
+func (m *TcmMetric) GetSeriesCache() *SeriesCache {
+	m.seriesLock.Lock()
+	defer m.seriesLock.Unlock()
+	return m.SeriesCache
+}
+
+func (m *TcmMetric) GetLatestPromMetrics(ctx context.Context, repo TcmMetricRepository) (pms []prometheus.Metric, err error) {
+	pms, _, err = m.QueryPromMetrics(ctx, repo)
+	return
+}
+
+// 与GetLatestPromMetrics相同, 同时返回本次查询的时间线和数据点数
+func (m *TcmMetric) QueryPromMetrics(ctx context.Context, repo TcmMetricRepository) (pms []prometheus.Metric, stats *TcmQueryStats, err error) {
 	var st int64
 	et := int64(0)
 	now := time.Now().Unix()
@@ -69,80 +133,143 @@ func (m *TcmMetric) GetLatestPromMetrics(repo TcmMetricRepository) (pms []promet
 		et = now
 	}
 
-	samplesList, err := repo.ListSamples(m, st, et)
-	if err != nil {
-		return nil, err
+	seriesCache := m.GetSeriesCache()
+	querySeries := m.getQuerySeries(seriesCache)
+	// 部分批次失败时仍导出已查询到的数据, 同时返回错误
+	samplesList, err := repo.ListSamples(ctx, m, st, et)
+	if err != nil && len(samplesList) == 0 {
+		return nil, nil, err
+	}
+	complete := err == nil && ctx.Err() == nil
+	returned := returnedSeries(seriesCache, samplesList)
+	stats = &TcmQueryStats{
+		Series:          len(querySeries),
+		SamplesReturned: countSamples(samplesList),
+		EmptySeries:     len(querySeries) - len(returned),
+	}
+	// 超时或部分失败的结果不计入
+	if complete {
+		m.updateNodata(seriesCache, returned)
 	}
+
+	// 同一个指标的时间线都使用LoadSeries时确定的标签集合, 不在集合中的标签不导出, 没有值的标签导出为空
+	var promSamples []*promSample
 	for _, samples := range samplesList {
 		for st, desc := range m.StatPromDesc {
-			var point *TcmSample
-			switch st {
-			case "last":
-				point, err = samples.GetLatestPoint()
-				if err != nil {
-					return nil, err
-				}
-			case "max":
-				point, err = samples.GetMaxPoint()
-				if err != nil {
-					return nil, err
-				}
-			case "min":
-				point, err = samples.GetMinPoint()
-				if err != nil {
-					return nil, err
-				}
-			case "avg":
-				point, err = samples.GetAvgPoint()
-				if err != nil {
-					return nil, err
-				}
+			aggregator, ok := GetAggregator(st)
+			if !ok {
+				return nil, nil, fmt.Errorf("statistics type not support, %s", st)
+			}
+			point, e := aggregator(samples)
+			if e != nil {
+				// 数据点不足等原因无法统计时跳过该时间线
+				continue
 			}
 			labels := m.Labels.GetValues(samples.Series.QueryLabels, samples.Series.Instance)
 			// add all dimensions from cloud monitor into prom labels
 			for _, dim := range point.Dimensions {
 				labels[*dim.Name] = *dim.Value
 			}
-			var names []string
-			var values []string
-			for k, v := range labels {
-				names = append(names, util.ToUnderlineLower(k))
-				values = append(values, v)
+			fqName, promLabels, keep := m.relabelSample(desc.FQName, labels)
+			if !keep {
+				continue
 			}
-			newDesc := prometheus.NewDesc(
-				desc.FQName,
-				desc.Help,
-				names,
-				nil,
-			)
-			var pm prometheus.Metric
-			if m.Conf.StatDelaySeconds > 0 {
-				pm = prometheus.NewMetricWithTimestamp(time.Unix(int64(point.Timestamp), 0), prometheus.MustNewConstMetric(
-					newDesc,
-					prometheus.GaugeValue,
-					point.Value,
-					values...,
-				))
-			} else {
-				pm = prometheus.MustNewConstMetric(
-					newDesc,
-					prometheus.GaugeValue,
-					point.Value,
-					values...,
-				)
-			}
-			pms = append(pms, pm)
+			promSamples = append(promSamples, &promSample{
+				seriesId:  samples.Series.Id,
+				fqName:    fqName,
+				desc:      desc,
+				labels:    promLabels,
+				timestamp: point.Timestamp,
+				value:     point.Value * desc.Scale,
+			})
 		}
 	}
 
+	// 没有数据的时间线按on_missing_data导出NaN或上次的值, 时间戳为本次查询的结束时间
+	promSamples = append(promSamples, m.fillMissing(promSamples, seriesCache, complete, float64(et))...)
+
+	names := seriesCache.PromLabelNames
+	usedDescs := map[string]struct{}{}
+	for _, s := range promSamples {
+		values := make([]string, 0, len(names))
+		for _, name := range names {
+			values = append(values, s.labels[name])
+		}
+		usedDescs[promDescKey(s.fqName, names)] = struct{}{}
+		pm, e := prometheus.NewConstMetric(m.getPromDesc(s.fqName, s.desc.Help, names), s.desc.ValueType, s.value, values...)
+		if e != nil {
+			// 标签值不是合法的utf8等, 跳过该时间线
+			continue
+		}
+		if m.Conf.StatDelaySeconds > 0 {
+			pm = prometheus.NewMetricWithTimestamp(time.Unix(int64(s.timestamp), 0), pm)
+		}
+		pms = append(pms, pm)
+	}
+	m.retainPromDescs(usedDescs)
+
 	return
 }
 
-func (m *TcmMetric) GetSeriesSplitByBatch(batch int) (steps [][]*TcmSeries) {
-	var series []*TcmSeries
-	for _, s := range m.SeriesCache.Series {
-		series = append(series, s)
+// 标签名转为小写加下划线后执行relabel, 返回导出的指标名和标签, false表示被relabel丢弃
+func (m *TcmMetric) relabelSample(fqName string, labels map[string]string) (string, map[string]string, bool) {
+	promLabels := map[string]string{}
+	for k, v := range labels {
+		promLabels[util.ToUnderlineLower(k)] = v
+	}
+	if len(m.Conf.RelabelConfigs) == 0 {
+		return fqName, promLabels, true
 	}
+	promLabels[model.MetricNameLabel] = fqName
+	promLabels, keep := relabel(promLabels, m.Conf.RelabelConfigs)
+	if !keep {
+		return "", nil, false
+	}
+	fqName = promLabels[model.MetricNameLabel]
+	if !model.IsValidMetricName(model.LabelValue(fqName)) {
+		return "", nil, false
+	}
+	return fqName, promLabels, true
+}
+
+// 按指标名和标签名缓存Desc, 避免每个时间线都创建
+func (m *TcmMetric) getPromDesc(fqName string, help string, labelNames []string) *prometheus.Desc {
+	key := promDescKey(fqName, labelNames)
+	m.descLock.Lock()
+	defer m.descLock.Unlock()
+	if m.promDescs == nil {
+		m.promDescs = map[string]*prometheus.Desc{}
+	}
+	desc, ok := m.promDescs[key]
+	if !ok {
+		desc = prometheus.NewDesc(fqName, help, labelNames, nil)
+		m.promDescs[key] = desc
+	}
+	return desc
+}
+
+// 只保留本次查询用到的Desc, 指标名被relabel改写或标签集合变化后, 旧的Desc不会一直保留
+func (m *TcmMetric) retainPromDescs(used map[string]struct{}) {
+	m.descLock.Lock()
+	defer m.descLock.Unlock()
+	for key := range m.promDescs {
+		if _, ok := used[key]; !ok {
+			delete(m.promDescs, key)
+		}
+	}
+}
+
+func promDescKey(fqName string, labelNames []string) string {
+	return fqName + "\xff" + strings.Join(labelNames, "\xff")
+}
+
+func (m *TcmMetric) GetSeriesSplitByBatch(batch int) (steps [][]*TcmSeries) {
+	return m.splitSeriesByBatch(m.GetSeriesCache(), batch)
+}
+
+// 按查询开始时的时间线缓存分批, 查询过程中LoadSeries替换缓存不影响本次查询
+func (m *TcmMetric) splitSeriesByBatch(cache *SeriesCache, batch int) (steps [][]*TcmSeries) {
+	series := m.getQuerySeries(cache)
 
 	total := len(series)
 	for i := 0; i < total/batch+1; i++ {
@@ -159,6 +286,32 @@ func (m *TcmMetric) GetSeriesSplitByBatch(batch int) (steps [][]*TcmSeries) {
 	return
 }
 
+// metric_name_template中可以使用的字段
+type TcmMetricNameData struct {
+	Namespace  string // 如QCE/CVM
+	Prefix     string // namespace的前缀小写, 如qce
+	Product    string // 产品名小写, 如cvm
+	Metric     string // 云监控指标名或tc_metric_rename, 如CpuUsage
+	Stat       string // 配置的统计方法, 如last、max
+	StatType   string // 云监控在该统计周期的统计方式, 如max
+	Unit       string // 云监控的单位, 如%
+	UnitSuffix string // 对应的Prometheus单位后缀, 如ratio
+	Period     int64  // 统计周期
+}
+
+// 渲染指标名, 结果必须是合法的Prometheus指标名
+func renderMetricName(t *template.Template, data *TcmMetricNameData) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	name := b.String()
+	if !model.IsValidMetricName(model.LabelValue(name)) {
+		return "", fmt.Errorf("metric_name_template produces invalid metric name %q", name)
+	}
+	return name, nil
+}
+
 // 创建TcmMetric
 func NewTcmMetric(meta *TcmMeta, conf *TcmMetricConfig) (*TcmMetric, error) {
 	id := fmt.Sprintf("%s-%s", meta.Namespace, meta.MetricName)
@@ -172,19 +325,36 @@ func NewTcmMetric(meta *TcmMeta, conf *TcmMetricConfig) (*TcmMetric, error) {
 	if err != nil {
 		return nil, err
 	}
-	help := fmt.Sprintf("Metric from %s.%s unit=%s stat=%s Desc=%s",
+	var periods []string
+	for _, p := range meta.GetPeriods() {
+		periods = append(periods, strconv.FormatInt(p, 10))
+	}
+	help := fmt.Sprintf("Metric from %s.%s unit=%s stat=%s Desc=%s dimensions=%s periods=%s",
 		meta.Namespace,
 		meta.MetricName,
-		*meta.m.Unit,
+		meta.GetUnit(),
 		statType,
-		*meta.m.Meaning.Zh,
+		meta.GetMeaning(conf.HelpLanguage),
+		strings.Join(meta.GetDimensions(), ","),
+		strings.Join(periods, ","),
 	)
+	var nameTemplate *template.Template
+	if conf.NameTemplate != "" {
+		nameTemplate, err = config.ParseMetricNameTemplate(conf.NameTemplate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	fqNames := map[string]string{}
 	for _, s := range conf.StatTypes {
 		var st string
 		if s == "last" {
 			st = strings.ToLower(statType)
 		} else {
 			st = strings.ToLower(s)
+			if _, ok := GetAggregator(st); !ok {
+				return nil, fmt.Errorf("statistics type not support, %s", s)
+			}
 		}
 
 		// 显示的指标名称
@@ -197,7 +367,7 @@ func NewTcmMetric(meta *TcmMeta, conf *TcmMetricConfig) (*TcmMetric, error) {
 
 		// 显示的指标名称格式化
 		var vmn string
-		if conf.MetricNameType == 1 {
+		if conf.MetricNameType == 1 || conf.NamingScheme == config.NamingSchemePrometheus {
 			vmn = util.ToUnderlineLower(mn)
 		} else {
 			vmn = strings.ToLower(mn)
@@ -209,9 +379,41 @@ func NewTcmMetric(meta *TcmMeta, conf *TcmMetricConfig) (*TcmMetric, error) {
 			st,
 		)
 		fqName = strings.ToLower(fqName)
+		unit := GetTcmUnit(meta.GetUnit()).ForStatType(strings.ToLower(s))
+		if nameTemplate != nil {
+			fqName, err = renderMetricName(nameTemplate, &TcmMetricNameData{
+				Namespace:  meta.Namespace,
+				Prefix:     strings.ToLower(conf.CustomNamespacePrefix),
+				Product:    strings.ToLower(conf.CustomProductName),
+				Metric:     mn,
+				Stat:       strings.ToLower(s),
+				StatType:   strings.ToLower(statType),
+				Unit:       meta.GetUnit(),
+				UnitSuffix: unit.Suffix,
+				Period:     conf.StatPeriodSeconds,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		scale := float64(1)
+		if conf.NamingScheme == config.NamingSchemePrometheus {
+			fqName = unit.AppendSuffix(fqName)
+			scale = unit.Scale
+		}
+		if other, ok := fqNames[fqName]; ok {
+			if nameTemplate != nil {
+				return nil, fmt.Errorf("metric name %s collides between statistics %s and %s", fqName, other, s)
+			}
+			// 原有命名中last使用统计周期的统计方式命名, 可能与配置的统计方法同名, 只导出一个
+			continue
+		}
+		fqNames[fqName] = s
 		statDescs[strings.ToLower(s)] = Desc{
-			FQName: fqName,
-			Help:   help,
+			FQName:    fqName,
+			Help:      help,
+			Scale:     scale,
+			ValueType: prometheus.GaugeValue,
 		}
 	}
 
@@ -0,0 +1,226 @@
+package metric
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	tccommon "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+	sdk "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cvm/v20170312"
+
+	"tencentcloud-exporter/pkg/common"
+	"tencentcloud-exporter/pkg/config"
+	"tencentcloud-exporter/pkg/fakecloud"
+	"tencentcloud-exporter/pkg/instance"
+)
+
+// 通过加载配置文件编译relabel规则
+func loadTestRelabelConfigs(t *testing.T, rules string) []*config.RelabelConfig {
+	content := `credential:
+  access_key: AKID
+  secret_key: secret
+  region: ap-guangzhou
+products:
+  - namespace: QCE/CVM
+    all_metrics: true
+    all_instances: true
+`
+	if rules != "" {
+		content += "metric_relabel_configs:" + strings.Replace(rules, "\n", "\n  ", -1) + "\n"
+	}
+	filename := filepath.Join(t.TempDir(), "qcloud.yml")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := config.NewConfig()
+	if err := conf.LoadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	return conf.MetricRelabelConfigs
+}
+
+func Test_promLabelNames(t *testing.T) {
+	cases := []struct {
+		name    string
+		relabel string
+		want    []string
+	}{
+		{"no relabel", ``, []string{"env", "instance_id", "instance_name", "vip"}},
+		{"replace", `
+- source_labels: [instance_name]
+  regex: 'web-(.*)'
+  target_label: app
+- source_labels: [instance_name]
+  target_label: '${1}_copy'
+`, []string{"app", "env", "instance_id", "instance_name", "vip"}},
+		{"labeldrop and hashmod", `
+- action: labeldrop
+  regex: 'instance_.*'
+- action: hashmod
+  source_labels: [vip]
+  modulus: 4
+  target_label: shard
+`, []string{"env", "shard", "vip"}},
+		{"labelmap and labelkeep", `
+- action: labelmap
+  regex: 'instance_(.*)'
+  replacement: 'ins_$1'
+- action: labelkeep
+  regex: 'ins_.*'
+`, []string{"ins_id", "ins_name"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rules := loadTestRelabelConfigs(t, c.relabel)
+			labels, err := NewTcmLabels([]string{"InstanceId"}, []string{"InstanceName"}, Labels{"env": "prod"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := &TcmMetric{Labels: labels, Conf: &TcmMetricConfig{RelabelConfigs: rules}}
+			// 查询维度中有元数据没有的vip
+			cache := newCache()
+			cache.LabelNames["vip"] = struct{}{}
+			cache.LabelNames["InstanceId"] = struct{}{}
+			ins, err := instance.NewCvmTcInstance("ins-1", &sdk.Instance{InstanceName: tccommon.StringPtr("web-1")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cache.Series["ins-1"] = &TcmSeries{QueryLabels: Labels{"InstanceId": "ins-1", "vip": "10.0.0.1"}, Instance: ins}
+			assert.Equal(t, c.want, m.promLabelNames(cache))
+		})
+	}
+}
+
+func Test_QueryPromMetricsTags(t *testing.T) {
+	s := fakecloud.NewServer("AKID", "secret")
+	defer s.Close()
+	s.AddMetric(fakecloud.NewMetricSet("QCE/CVM", "CpuUsage", "%", "max", []int64{60, 300}, []string{"InstanceId"}))
+	s.SetMetricValues("QCE/CVM", "CpuUsage", func(dimensions map[string]string, ts int64) (float64, bool) {
+		return 1, true
+	})
+
+	conf := newFakeCloudConfig(t, s)
+	cred := &common.Credential{SecretId: conf.Credential.AccessKey, SecretKey: conf.Credential.SecretKey}
+	repo, err := NewTcmMetricRepository(cred, conf, NewTcmBudget(conf, log.NewNopLogger()), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := repo.GetMeta("QCE/CVM", "CpuUsage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pconf, err := conf.GetProductConfig("QCE/CVM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pconf.ExtraLabels = []string{"InstanceName", "Tags"}
+	pconf.Statistics = []string{"max"}
+	mconf, err := NewTcmMetricConfigWithProductYaml(pconf, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewTcmMetric(meta, mconf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tags展开为每个标签键, 不同实例的标签键不同
+	tags := map[string][]*sdk.Tag{
+		"ins-1": {{Key: tccommon.StringPtr("env"), Value: tccommon.StringPtr("prod")}},
+		"ins-2": {{Key: tccommon.StringPtr("team"), Value: tccommon.StringPtr("infra")}},
+	}
+	var series []*TcmSeries
+	for _, id := range []string{"ins-1", "ins-2"} {
+		ins, err := instance.NewCvmTcInstance(id, &sdk.Instance{
+			InstanceId:   tccommon.StringPtr(id),
+			InstanceName: tccommon.StringPtr("web-" + id),
+			Tags:         tags[id],
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := NewTcmSeries(m, Labels{"InstanceId": id}, ins)
+		if err != nil {
+			t.Fatal(err)
+		}
+		series = append(series, s)
+	}
+	if err := m.LoadSeries(series); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"env", "instance_id", "instance_name", "team"}, m.GetSeriesCache().PromLabelNames)
+
+	pms, err := m.GetLatestPromMetrics(context.Background(), repo)
+	assert.NoError(t, err)
+	got := map[string]map[string]string{}
+	for _, pm := range pms {
+		var d dto.Metric
+		if err := pm.Write(&d); err != nil {
+			t.Fatal(err)
+		}
+		labels := map[string]string{}
+		for _, l := range d.Label {
+			labels[l.GetName()] = l.GetValue()
+		}
+		got[labels["instance_id"]] = labels
+	}
+	assert.Equal(t, map[string]map[string]string{
+		"ins-1": {"env": "prod", "instance_id": "ins-1", "instance_name": "web-ins-1", "team": ""},
+		"ins-2": {"env": "", "instance_id": "ins-2", "instance_name": "web-ins-2", "team": "infra"},
+	}, got)
+}
+
+func Test_PromDescCache(t *testing.T) {
+	m := &TcmMetric{}
+	names := []string{"instance_id"}
+	desc := m.getPromDesc("qce_cvm_cpuusage_max", "help", names)
+	assert.Same(t, desc, m.getPromDesc("qce_cvm_cpuusage_max", "help", names))
+	m.getPromDesc("qce_cvm_renamed_max", "help", names)
+	assert.Len(t, m.promDescs, 2)
+
+	// 本次查询没有用到的Desc被移除
+	m.retainPromDescs(map[string]struct{}{promDescKey("qce_cvm_renamed_max", names): {}})
+	assert.Len(t, m.promDescs, 1)
+	assert.NotSame(t, desc, m.getPromDesc("qce_cvm_cpuusage_max", "help", names))
+}
+
+func Test_NewTcmMetricNameTemplate(t *testing.T) {
+	meta, err := NewTcmMeta(fakecloud.NewMetricSet("QCE/CVM", "CpuUsage", "%", "max", []int64{60, 300}, []string{"InstanceId"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newMetric := func(template string, stats ...string) (*TcmMetric, error) {
+		return NewTcmMetric(meta, &TcmMetricConfig{
+			CustomNamespacePrefix: "QCE",
+			CustomProductName:     "CVM",
+			StatTypes:             stats,
+			StatPeriodSeconds:     60,
+			NameTemplate:          template,
+		})
+	}
+
+	m, err := newMetric(`{{.Prefix}}_{{.Product}}_{{snake .Metric}}{{if ne .Stat "last"}}_{{.Stat}}{{end}}_{{.UnitSuffix}}`, "last", "p99")
+	if assert.NoError(t, err) {
+		var names []string
+		for _, desc := range m.StatPromDesc {
+			names = append(names, desc.FQName)
+		}
+		assert.ElementsMatch(t, []string{"qce_cvm_cpu_usage_ratio", "qce_cvm_cpu_usage_p99_ratio"}, names)
+	}
+
+	// 不同统计方法生成相同的指标名
+	_, err = newMetric("{{.Prefix}}_{{.Product}}_{{snake .Metric}}", "max", "min")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "collides")
+	}
+	// 生成的指标名不合法
+	_, err = newMetric("{{.Product}}_{{.Unit}}", "max")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid metric name")
+	}
+}
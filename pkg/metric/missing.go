@@ -0,0 +1,114 @@
+package metric
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"tencentcloud-exporter/pkg/config"
+)
+
+// 导出前的单个时间线
+type promSample struct {
+	seriesId  string
+	fqName    string
+	desc      Desc
+	labels    map[string]string
+	timestamp float64
+	value     float64
+}
+
+// 时间线上次导出的值, 用于on_missing_data
+type lastValue struct {
+	sample *promSample
+	seen   time.Time
+}
+
+func (s *promSample) key() string {
+	var kvs []string
+	for k, v := range s.labels {
+		if strings.HasPrefix(k, model.ReservedLabelPrefix) {
+			continue
+		}
+		kvs = append(kvs, k+"\xfe"+v)
+	}
+	sort.Strings(kvs)
+	return s.fqName + "\xff" + strings.Join(kvs, "\xff")
+}
+
+// 按on_missing_data补充本次没有数据的时间线, 实例已不在缓存中或last_known过期的时间线不再补充;
+// nan时从未返回过数据的时间线也按实例的标签补充; complete为false时本次查询未完成, 只更新上次的值
+func (m *TcmMetric) fillMissing(samples []*promSample, cache *SeriesCache, complete bool, timestamp float64) []*promSample {
+	policy := m.Conf.OnMissingData
+	if policy == "" || policy == config.OnMissingDataDrop {
+		return nil
+	}
+	m.lastValuesLock.Lock()
+	defer m.lastValuesLock.Unlock()
+	if m.lastValues == nil {
+		m.lastValues = map[string]*lastValue{}
+	}
+	now := time.Now()
+	current := map[string]struct{}{}
+	// 已导出的时间线和统计方法
+	covered := map[string]struct{}{}
+	for _, s := range samples {
+		key := s.key()
+		current[key] = struct{}{}
+		covered[s.seriesId+"\xff"+s.desc.FQName] = struct{}{}
+		m.lastValues[key] = &lastValue{sample: s, seen: now}
+	}
+
+	var filled []*promSample
+	for key, lv := range m.lastValues {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		if _, ok := cache.Series[lv.sample.seriesId]; !ok {
+			delete(m.lastValues, key)
+			continue
+		}
+		if policy == config.OnMissingDataLastKnown && now.Sub(lv.seen) > m.Conf.MissingDataTTL {
+			delete(m.lastValues, key)
+			continue
+		}
+		if !complete {
+			continue
+		}
+		s := *lv.sample
+		s.timestamp = timestamp
+		if policy == config.OnMissingDataNaN {
+			s.value = math.NaN()
+		}
+		covered[s.seriesId+"\xff"+s.desc.FQName] = struct{}{}
+		filled = append(filled, &s)
+	}
+	if policy != config.OnMissingDataNaN || !complete {
+		return filled
+	}
+
+	// 启动后一直没有数据的时间线, 如启动前已关机的实例, 标签使用查询维度和实例字段
+	for _, series := range cache.Series {
+		for _, desc := range m.StatPromDesc {
+			if _, ok := covered[series.Id+"\xff"+desc.FQName]; ok {
+				continue
+			}
+			fqName, labels, keep := m.relabelSample(desc.FQName, m.Labels.GetValues(series.QueryLabels, series.Instance))
+			if !keep {
+				continue
+			}
+			filled = append(filled, &promSample{
+				seriesId:  series.Id,
+				fqName:    fqName,
+				desc:      desc,
+				labels:    labels,
+				timestamp: timestamp,
+				value:     math.NaN(),
+			})
+		}
+	}
+	return filled
+}
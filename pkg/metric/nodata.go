@@ -0,0 +1,78 @@
+package metric
+
+import (
+	"sort"
+
+	"tencentcloud-exporter/pkg/config"
+)
+
+// 返回了数据点的时间线id
+func returnedSeries(cache *SeriesCache, samplesList []*TcmSamples) map[string]struct{} {
+	returned := map[string]struct{}{}
+	for _, samples := range samplesList {
+		if _, ok := cache.Series[samples.Series.Id]; ok && len(samples.Samples) != 0 {
+			returned[samples.Series.Id] = struct{}{}
+		}
+	}
+	return returned
+}
+
+func (m *TcmMetric) nodataThreshold() int {
+	if m.Conf.NodataThreshold > 0 {
+		return m.Conf.NodataThreshold
+	}
+	return config.DefaultNodataThreshold
+}
+
+// 按本次查询结果更新每个时间线连续没有数据的次数, 返回了数据的时间线清零
+func (m *TcmMetric) updateNodata(cache *SeriesCache, returned map[string]struct{}) {
+	m.nodataLock.Lock()
+	defer m.nodataLock.Unlock()
+	// LoadSeries之后重新计数
+	if m.nodataCache != cache {
+		m.nodataCache = cache
+		m.nodataCounts = map[string]int{}
+	}
+	for id := range cache.Series {
+		if _, ok := returned[id]; ok {
+			delete(m.nodataCounts, id)
+		} else {
+			m.nodataCounts[id]++
+		}
+	}
+}
+
+func (m *TcmMetric) isNodata(cache *SeriesCache, id string) bool {
+	return m.nodataCache == cache && m.nodataCounts[id] >= m.nodataThreshold()
+}
+
+// 连续nodata_threshold次查询没有数据点的时间线, 按id排序
+func (m *TcmMetric) GetNodataSeries() []*TcmSeries {
+	cache := m.GetSeriesCache()
+	m.nodataLock.Lock()
+	defer m.nodataLock.Unlock()
+	var series []*TcmSeries
+	for id, s := range cache.Series {
+		if m.isNodata(cache, id) {
+			series = append(series, s)
+		}
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return series[i].Id < series[j].Id
+	})
+	return series
+}
+
+// 需要查询的时间线, 开启skip_nodata_series时跳过没有数据的时间线, 直到下次LoadSeries
+func (m *TcmMetric) getQuerySeries(cache *SeriesCache) []*TcmSeries {
+	var series []*TcmSeries
+	m.nodataLock.Lock()
+	defer m.nodataLock.Unlock()
+	for id, s := range cache.Series {
+		if m.Conf.SkipNodataSeries && m.isNodata(cache, id) {
+			continue
+		}
+		series = append(series, s)
+	}
+	return series
+}
@@ -1,28 +1,138 @@
 package metric
 
 import (
+	"context"
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+const (
+	QueryStatusDone    = 1
+	QueryStatusRunning = 2
+)
+
 // 负责一个指标的查询管理
 type TcmQuery struct {
 	Metric            *TcmMetric
 	LatestQueryStatus int
 	repo              TcmMetricRepository
+	latestPromMetrics []prometheus.Metric // 因预算降低采集频率时返回上次的结果
+	latestQueryTime   time.Time
+	latestDuration    time.Duration
+	latestErr         error
+	latestStats       *TcmQueryStats // 最近一次实际查询云API的统计, 因预算跳过的查询不更新
+	mu                sync.Mutex
 }
 
 type TcmQuerySet []*TcmQuery
 
-func (q *TcmQuery) GetPromMetrics() (pms []prometheus.Metric, err error) {
-	q.LatestQueryStatus = 2
+// 一次查询的时间线和数据点数
+type TcmQueryStats struct {
+	Series          int // 查询的时间线数, 不包含跳过的没有数据的时间线
+	SamplesReturned int // 返回的数据点数
+	EmptySeries     int // 没有返回数据点的时间线数
+}
 
-	pms, err = q.Metric.GetLatestPromMetrics(q.repo)
-	if err != nil {
-		return
+func countSamples(samplesList []*TcmSamples) int {
+	var n int
+	for _, samples := range samplesList {
+		n += len(samples.Samples)
 	}
+	return n
+}
 
-	q.LatestQueryStatus = 1
-	return
+// 指标最近一次查询的状态, 用于/status页面
+type TcmQueryStatus struct {
+	MetricName      string              `json:"metric_name"`
+	Id              string              `json:"id"`
+	NumSeries       int                 `json:"num_series"`
+	Status          string              `json:"status"` // never=未查询过, running=查询中, done=已完成
+	LatestQueryTime time.Time           `json:"latest_query_time"`
+	LatestSeconds   float64             `json:"latest_seconds"`
+	LatestError     string              `json:"latest_error,omitempty"`
+	LatestPoints    int                 `json:"latest_points"` // 上次导出的时间线数
+	SamplesReturned int                 `json:"samples_returned"`
+	EmptySeries     int                 `json:"empty_series"`
+	NodataSeries    []map[string]string `json:"nodata_series"` // 连续多次没有数据点的时间线的查询维度
+}
+
+func (q *TcmQuery) GetPromMetrics(ctx context.Context) (pms []prometheus.Metric, err error) {
+	start := time.Now()
+	q.mu.Lock()
+	q.LatestQueryStatus = QueryStatusRunning
+	q.latestQueryTime = start
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		q.LatestQueryStatus = QueryStatusDone
+		q.latestDuration = time.Since(start)
+		q.latestErr = err
+		q.mu.Unlock()
+	}()
+
+	pms, stats, err := q.Metric.QueryPromMetrics(ctx, q.repo)
+	if err == ErrBudgetThrottled {
+		q.mu.Lock()
+		pms = q.latestPromMetrics
+		q.mu.Unlock()
+		return pms, nil
+	}
+	if err == ErrBudgetDropped {
+		return nil, nil
+	}
+	q.mu.Lock()
+	if stats != nil {
+		q.latestStats = stats
+	}
+	// 部分失败时不缓存, 预算限流时返回上次完整的结果
+	if err == nil {
+		q.latestPromMetrics = pms
+	}
+	q.mu.Unlock()
+	// 预算用完停止查询时导出已查询到的部分
+	return pms, withoutBudgetExceeded(err)
+}
+
+// 最近一次查询云API的统计, 未查询成功过时为nil
+func (q *TcmQuery) LatestStats() *TcmQueryStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.latestStats
+}
+
+func (q *TcmQuery) Status() *TcmQueryStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := &TcmQueryStatus{
+		MetricName:      q.Metric.Meta.MetricName,
+		Id:              q.Metric.Id,
+		NumSeries:       len(q.Metric.GetSeriesCache().Series),
+		LatestQueryTime: q.latestQueryTime,
+		LatestSeconds:   q.latestDuration.Seconds(),
+		LatestPoints:    len(q.latestPromMetrics),
+	}
+	switch q.LatestQueryStatus {
+	case QueryStatusRunning:
+		s.Status = "running"
+	case QueryStatusDone:
+		s.Status = "done"
+	default:
+		s.Status = "never"
+	}
+	if q.latestErr != nil {
+		s.LatestError = q.latestErr.Error()
+	}
+	if q.latestStats != nil {
+		s.SamplesReturned = q.latestStats.SamplesReturned
+		s.EmptySeries = q.latestStats.EmptySeries
+	}
+	s.NodataSeries = []map[string]string{}
+	for _, series := range q.Metric.GetNodataSeries() {
+		s.NodataSeries = append(s.NodataSeries, series.QueryLabels)
+	}
+	return s
 }
 
 func (qs TcmQuerySet) SplitByBatch(batch int) (steps [][]*TcmQuery) {
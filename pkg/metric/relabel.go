@@ -0,0 +1,124 @@
+package metric
+
+import (
+	"crypto/md5"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/common/model"
+
+	"tencentcloud-exporter/pkg/config"
+)
+
+// 按顺序执行relabel规则, 指标名以__name__参与, 返回false表示丢弃该时间线
+func relabel(labels map[string]string, rules []*config.RelabelConfig) (map[string]string, bool) {
+	for _, rule := range rules {
+		var values []string
+		for _, name := range rule.SourceLabels {
+			values = append(values, labels[name])
+		}
+		value := strings.Join(values, rule.Separator)
+		regex := rule.GetRegex()
+
+		switch rule.Action {
+		case config.RelabelKeep:
+			if !regex.MatchString(value) {
+				return nil, false
+			}
+		case config.RelabelDrop:
+			if regex.MatchString(value) {
+				return nil, false
+			}
+		case config.RelabelReplace:
+			indexes := regex.FindStringSubmatchIndex(value)
+			if indexes == nil {
+				continue
+			}
+			target := string(regex.ExpandString(nil, rule.TargetLabel, value, indexes))
+			if !model.LabelName(target).IsValid() {
+				continue
+			}
+			res := string(regex.ExpandString(nil, rule.Replacement, value, indexes))
+			if res == "" {
+				delete(labels, target)
+			} else {
+				labels[target] = res
+			}
+		case config.RelabelHashMod:
+			labels[rule.TargetLabel] = fmt.Sprintf("%d", sum64(md5.Sum([]byte(value)))%rule.Modulus)
+		case config.RelabelLabelMap:
+			mapped := map[string]string{}
+			for name, v := range labels {
+				if regex.MatchString(name) {
+					mapped[regex.ReplaceAllString(name, rule.Replacement)] = v
+				}
+			}
+			for name, v := range mapped {
+				labels[name] = v
+			}
+		case config.RelabelLabelDrop:
+			for name := range labels {
+				if name != model.MetricNameLabel && regex.MatchString(name) {
+					delete(labels, name)
+				}
+			}
+		case config.RelabelLabelKeep:
+			for name := range labels {
+				if name != model.MetricNameLabel && !regex.MatchString(name) {
+					delete(labels, name)
+				}
+			}
+		}
+	}
+	return labels, true
+}
+
+// 按relabel规则推导导出的标签名, 不依赖标签值
+// replace只有部分时间线匹配时, 其余时间线的目标标签为空; target_label引用分组时无法确定, 不导出
+func relabelLabelNames(names map[string]struct{}, rules []*config.RelabelConfig) map[string]struct{} {
+	for _, rule := range rules {
+		regex := rule.GetRegex()
+		switch rule.Action {
+		case config.RelabelReplace:
+			if strings.Contains(rule.TargetLabel, "$") {
+				continue
+			}
+			names[rule.TargetLabel] = struct{}{}
+		case config.RelabelHashMod:
+			names[rule.TargetLabel] = struct{}{}
+		case config.RelabelLabelMap:
+			var mapped []string
+			for name := range names {
+				if regex.MatchString(name) {
+					mapped = append(mapped, regex.ReplaceAllString(name, rule.Replacement))
+				}
+			}
+			for _, name := range mapped {
+				names[name] = struct{}{}
+			}
+		case config.RelabelLabelDrop:
+			for name := range names {
+				if regex.MatchString(name) {
+					delete(names, name)
+				}
+			}
+		case config.RelabelLabelKeep:
+			for name := range names {
+				if !regex.MatchString(name) {
+					delete(names, name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// 与Prometheus的hashmod保持一致
+func sum64(hash [md5.Size]byte) uint64 {
+	var s uint64
+	for i, b := range hash {
+		shift := uint64((md5.Size - 1 - i) * 8)
+		s |= uint64(b) << shift
+	}
+	return s
+}
@@ -0,0 +1,114 @@
+package metric
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_relabel(t *testing.T) {
+	base := func() map[string]string {
+		return map[string]string{
+			"__name__":      "qce_cvm_cpuusage_max",
+			"instance_id":   "ins-1",
+			"instance_name": "web-1",
+			"vpc_id":        "vpc-1",
+		}
+	}
+	cases := []struct {
+		name  string
+		rules string
+		keep  bool
+		want  map[string]string
+	}{
+		{"replace", `
+- source_labels: [instance_name]
+  regex: 'web-(.*)'
+  target_label: app
+  replacement: 'web_$1'
+`, true, map[string]string{"__name__": "qce_cvm_cpuusage_max", "instance_id": "ins-1", "instance_name": "web-1", "vpc_id": "vpc-1", "app": "web_1"}},
+		{"replace not match", `
+- source_labels: [instance_name]
+  regex: 'db-(.*)'
+  target_label: app
+`, true, base()},
+		{"replace empty deletes", `
+- source_labels: [vpc_id]
+  target_label: vpc_id
+  replacement: ''
+`, true, map[string]string{"__name__": "qce_cvm_cpuusage_max", "instance_id": "ins-1", "instance_name": "web-1"}},
+		{"rename metric", `
+- source_labels: [__name__]
+  regex: 'qce_cvm_(.*)'
+  target_label: __name__
+  replacement: 'cvm_$1'
+`, true, map[string]string{"__name__": "cvm_cpuusage_max", "instance_id": "ins-1", "instance_name": "web-1", "vpc_id": "vpc-1"}},
+		{"keep", `
+- action: keep
+  source_labels: [instance_id, instance_name]
+  regex: 'ins-1;web-.*'
+`, true, base()},
+		{"keep not match", `
+- action: keep
+  source_labels: [instance_name]
+  regex: 'db-.*'
+`, false, nil},
+		{"drop", `
+- action: drop
+  source_labels: [vpc_id]
+  regex: 'vpc-1'
+`, false, nil},
+		{"labeldrop keeps name", `
+- action: labeldrop
+  regex: '.*_id|__name__'
+`, true, map[string]string{"__name__": "qce_cvm_cpuusage_max", "instance_name": "web-1"}},
+		{"labelkeep", `
+- action: labelkeep
+  regex: 'instance_.*'
+`, true, map[string]string{"__name__": "qce_cvm_cpuusage_max", "instance_id": "ins-1", "instance_name": "web-1"}},
+		{"labelmap", `
+- action: labelmap
+  regex: 'instance_(.*)'
+  replacement: 'ins_$1'
+`, true, map[string]string{"__name__": "qce_cvm_cpuusage_max", "instance_id": "ins-1", "instance_name": "web-1", "vpc_id": "vpc-1", "ins_id": "ins-1", "ins_name": "web-1"}},
+		{"hashmod", `
+- action: hashmod
+  source_labels: [instance_id]
+  modulus: 1
+  target_label: shard
+`, true, map[string]string{"__name__": "qce_cvm_cpuusage_max", "instance_id": "ins-1", "instance_name": "web-1", "vpc_id": "vpc-1", "shard": "0"}},
+		{"rules in order", `
+- source_labels: [instance_name]
+  target_label: name
+- action: labeldrop
+  regex: 'instance_name'
+`, true, map[string]string{"__name__": "qce_cvm_cpuusage_max", "instance_id": "ins-1", "name": "web-1", "vpc_id": "vpc-1"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			labels, keep := relabel(base(), loadTestRelabelConfigs(t, c.rules))
+			assert.Equal(t, c.keep, keep)
+			if c.keep {
+				assert.Equal(t, c.want, labels)
+			}
+		})
+	}
+}
+
+func Test_relabelHashMod(t *testing.T) {
+	rules := loadTestRelabelConfigs(t, `
+- action: hashmod
+  source_labels: [instance_id]
+  modulus: 8
+  target_label: shard
+`)
+	// 相同的值总是分到相同的分片
+	shard := func(id string) string {
+		labels, _ := relabel(map[string]string{"instance_id": id}, rules)
+		return labels["shard"]
+	}
+	assert.Equal(t, shard("ins-1"), shard("ins-1"))
+	for _, id := range []string{"ins-1", "ins-2", "ins-3"} {
+		assert.Contains(t, []string{"0", "1", "2", "3", "4", "5", "6", "7"}, shard(id))
+	}
+}
@@ -2,14 +2,16 @@ package metric
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	"golang.org/x/time/rate"
 
+	sdkerrors "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
 	monitor "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/monitor/v20180724"
 	v20180724 "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/monitor/v20180724"
 
@@ -23,6 +25,11 @@ var (
 	timeStampFormat = "2006-01-02 15:04:05"
 )
 
+const (
+	// 同一个指标并发查询的批次数, 总请求速率仍受limiter限制
+	queryBatchConcurrency = 5
+)
+
 // 腾讯云监控指标Repository
 type TcmMetricRepository interface {
 	// 获取指标的元数据
@@ -30,9 +37,9 @@ type TcmMetricRepository interface {
 	// 根据namespace获取所有的指标元数据
 	ListMetaByNamespace(namespace string) ([]*TcmMeta, error)
 	// 按时间范围获取单个时间线的数据点
-	GetSamples(series *TcmSeries, startTime int64, endTime int64) (samples *TcmSamples, err error)
-	// 按时间范围获取单个指标下所有时间线的数据点
-	ListSamples(metric *TcmMetric, startTime int64, endTime int64) (samplesList []*TcmSamples, err error)
+	GetSamples(ctx context.Context, series *TcmSeries, startTime int64, endTime int64) (samples *TcmSamples, err error)
+	// 按时间范围获取单个指标下所有时间线的数据点, ctx结束时返回已经查询到的数据
+	ListSamples(ctx context.Context, metric *TcmMetric, startTime int64, endTime int64) (samplesList []*TcmSamples, err error)
 }
 
 type TcmMetricRepositoryImpl struct {
@@ -40,24 +47,18 @@ type TcmMetricRepositoryImpl struct {
 	monitorClient            *monitor.Client
 	monitorClientInGuangzhou *monitor.Client
 	monitorClientInSinapore  *monitor.Client
-	limiter                  *rate.Limiter // 限速
-	ctx                      context.Context
+	limiters                 map[string]*client.Limiter // 按产品限速, 未配置的产品只受GetMonitorData限速
+	budget                   *TcmBudget                 // 调用预算
 	IsInternational          bool
 
-	queryMetricBatchSize int
+	queryMetricBatchSize     int
+	queryMetricMaxDataPoints int
 
 	logger log.Logger
 }
 
 func (repo *TcmMetricRepositoryImpl) GetMeta(namespace string, name string) (meta *TcmMeta, err error) {
-	// 限速
-	ctx, cancel := context.WithCancel(repo.ctx)
-	defer cancel()
-	err = repo.limiter.Wait(ctx)
-	if err != nil {
-		return
-	}
-
+	// 限速由client的transport按action统一处理
 	request := monitor.NewDescribeBaseMetricsRequest()
 	request.Namespace = &namespace
 	request.MetricName = &name
@@ -76,15 +77,6 @@ func (repo *TcmMetricRepositoryImpl) GetMeta(namespace string, name string) (met
 }
 
 func (repo *TcmMetricRepositoryImpl) ListMetaByNamespace(namespace string) (metas []*TcmMeta, err error) {
-	// 限速
-	ctx, cancel := context.WithCancel(repo.ctx)
-	defer cancel()
-
-	err = repo.limiter.Wait(ctx)
-	if err != nil {
-		return
-	}
-
 	request := monitor.NewDescribeBaseMetricsRequest()
 	request.Namespace = &namespace
 	response, err := repo.monitorClient.DescribeBaseMetrics(request)
@@ -101,16 +93,15 @@ func (repo *TcmMetricRepositoryImpl) ListMetaByNamespace(namespace string) (meta
 	return
 }
 
-func (repo *TcmMetricRepositoryImpl) GetSamples(s *TcmSeries, st int64, et int64) (samples *TcmSamples, err error) {
+func (repo *TcmMetricRepositoryImpl) GetSamples(ctx context.Context, s *TcmSeries, st int64, et int64) (samples *TcmSamples, err error) {
 	// 限速
-	ctx, cancel := context.WithCancel(repo.ctx)
-	defer cancel()
-	err = repo.limiter.Wait(ctx)
+	err = repo.wait(ctx, s.Metric.Meta.Namespace)
 	if err != nil {
 		return
 	}
 
 	request := monitor.NewGetMonitorDataRequest()
+	request.SetContext(ctx)
 	request.Namespace = &s.Metric.Meta.Namespace
 	request.MetricName = &s.Metric.Meta.MetricName
 
@@ -134,9 +125,14 @@ func (repo *TcmMetricRepositoryImpl) GetSamples(s *TcmSeries, st int64, et int64
 		request.EndTime = &etStr
 	}
 
+	err = repo.budget.Reserve(s.Metric)
+	if err != nil {
+		return
+	}
+	request.SetContext(repo.budget.withRetryReserve(ctx, s.Metric))
 	start := time.Now()
 	response := &v20180724.GetMonitorDataResponse{}
-	response, err = repo.getMonitorDataWithRetry(s.Metric.Meta.ProductName, request)
+	response, err = repo.getMonitorData(s.Metric.Meta.ProductName, request)
 	if err != nil {
 		level.Error(repo.logger).Log(
 			"request start time ", stStr, "duration ", time.Since(start).Seconds(), "err ", err.Error())
@@ -154,74 +150,187 @@ func (repo *TcmMetricRepositoryImpl) GetSamples(s *TcmSeries, st int64, et int64
 	return
 }
 
-func (repo *TcmMetricRepositoryImpl) getMonitorDataWithRetry(
+// 产品配置了rate_limit时, 在GetMonitorData限速之外再按产品限速
+func (repo *TcmMetricRepositoryImpl) wait(ctx context.Context, namespace string) error {
+	l, ok := repo.limiters[strings.ToLower(namespace)]
+	if !ok {
+		return nil
+	}
+	return l.Wait(ctx)
+}
+
+// 重试由client的transport统一处理, 这里只选择查询的地域, 请求的ctx传给transport
+func (repo *TcmMetricRepositoryImpl) getMonitorData(
 	productName string, request *monitor.GetMonitorDataRequest) (*v20180724.GetMonitorDataResponse, error) {
-	var lastErr error
 	monitorClient := repo.monitorClient
 	if repo.IsInternational && productName == "QAAP" {
 		monitorClient = repo.monitorClientInSinapore
 	} else if util.IsStrInList(config.QcloudNamespace, productName) {
 		monitorClient = repo.monitorClientInGuangzhou
 	}
-	for i := 0; i < 3; i++ {
-		resp, err := monitorClient.GetMonitorData(request)
-		if err != nil {
-			if strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
-				lastErr = err
-				continue
-			}
-			return nil, err
+	return monitorClient.GetMonitorDataWithContext(request.GetContext(), request)
+}
+
+func (repo *TcmMetricRepositoryImpl) ListSamples(ctx context.Context, m *TcmMetric, st int64, et int64) ([]*TcmSamples, error) {
+	if err := repo.budget.Admit(m); err != nil {
+		return nil, err
+	}
+
+	var (
+		samplesList []*TcmSamples
+		errs        []error
+		lock        sync.Mutex
+		wg          sync.WaitGroup
+		sem         = make(chan struct{}, queryBatchConcurrency)
+		cache       = m.GetSeriesCache()
+		exceeded    bool // 预算用完后不再查询剩余批次
+	)
+	for _, seriesList := range m.splitSeriesByBatch(cache, repo.getBatchSize(m, st, et)) {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
 		}
-		return resp, nil
+		lock.Lock()
+		stop := exceeded
+		lock.Unlock()
+		if stop {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(seriesList []*TcmSeries) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			sl, err := repo.listSampleBySplitBatch(ctx, m, cache, seriesList, st, et)
+			lock.Lock()
+			samplesList = append(samplesList, sl...)
+			// 并发中的批次预算用完时只保留一个错误
+			if err != nil && !(err == ErrBudgetExceeded && exceeded) {
+				errs = append(errs, err)
+			}
+			if errors.Is(err, ErrBudgetExceeded) {
+				exceeded = true
+			}
+			lock.Unlock()
+		}(seriesList)
 	}
-	return nil, lastErr
+	wg.Wait()
+	// 部分批次失败时同时返回已查询到的数据和所有批次的错误
+	return samplesList, errors.Join(errs...)
 }
 
-func (repo *TcmMetricRepositoryImpl) ListSamples(m *TcmMetric, st int64, et int64) ([]*TcmSamples, error) {
-	var samplesList []*TcmSamples
-	for _, seriesList := range m.GetSeriesSplitByBatch(repo.queryMetricBatchSize) {
-		sl, err := repo.listSampleByBatch(m, seriesList, st, et)
-		if err != nil {
-			level.Error(repo.logger).Log("msg", err.Error())
-			continue
-		}
-		samplesList = append(samplesList, sl...)
+// 按单请求数据点数上限(实例数 × 每个实例的数据点数)计算每批的实例数
+func (repo *TcmMetricRepositoryImpl) getBatchSize(m *TcmMetric, st int64, et int64) int {
+	if et == 0 {
+		et = time.Now().Unix()
 	}
-	return samplesList, nil
+	numSamples := m.Conf.StatNumSamples
+	if m.Conf.StatPeriodSeconds > 0 && et > st {
+		numSamples = (et-st)/m.Conf.StatPeriodSeconds + 1
+	}
+	size := repo.queryMetricBatchSize
+	if numSamples > 0 && int64(repo.queryMetricMaxDataPoints)/numSamples < int64(size) {
+		size = int(int64(repo.queryMetricMaxDataPoints) / numSamples)
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// 返回数据点过多时将批次对半拆分后重试, 直到单个实例
+// 超时或取消导致的失败不返回错误, 由调用方按ctx处理
+func (repo *TcmMetricRepositoryImpl) listSampleBySplitBatch(
+	ctx context.Context,
+	m *TcmMetric,
+	cache *SeriesCache,
+	seriesList []*TcmSeries,
+	st int64,
+	et int64,
+) ([]*TcmSamples, error) {
+	sl, err := repo.listSampleByBatch(ctx, m, cache, seriesList, st, et)
+	if err == nil {
+		return sl, nil
+	}
+	if len(seriesList) > 1 && isTooManyDataPointsError(err) {
+		half := len(seriesList) / 2
+		level.Warn(repo.logger).Log("msg", "Too many data points, split batch and retry",
+			"metric", m.Meta.MetricName, "batch", len(seriesList))
+		sl, err1 := repo.listSampleBySplitBatch(ctx, m, cache, seriesList[:half], st, et)
+		sl2, err2 := repo.listSampleBySplitBatch(ctx, m, cache, seriesList[half:], st, et)
+		return append(sl, sl2...), errors.Join(err1, err2)
+	}
+	if ctx.Err() != nil {
+		return nil, nil
+	}
+	return nil, err
+}
+
+// 单请求数据点数超过上限的错误, 可以拆分批次重试;
+// 限频、配额等其他LimitExceeded错误拆分后只会增加调用次数, 不能匹配
+func isTooManyDataPointsError(err error) bool {
+	sdkErr, ok := err.(*sdkerrors.TencentCloudSDKError)
+	if !ok {
+		return false
+	}
+	if sdkErr.Code == "LimitExceeded.MetricQueryPointNumber" {
+		return true
+	}
+	isCode := func(code string) bool {
+		return sdkErr.Code == code || strings.HasPrefix(sdkErr.Code, code+".")
+	}
+	if !isCode("LimitExceeded") && !isCode("InvalidParameter") && !isCode("InvalidParameterValue") {
+		return false
+	}
+	msg := strings.ToLower(sdkErr.Message)
+	if !strings.Contains(msg, "data point") && !strings.Contains(msg, "datapoint") && !strings.Contains(msg, "数据点") {
+		return false
+	}
+	return strings.Contains(msg, "too many") || strings.Contains(msg, "exceed") || strings.Contains(msg, "超过")
 }
 
 func (repo *TcmMetricRepositoryImpl) listSampleByBatch(
+	ctx context.Context,
 	m *TcmMetric,
+	cache *SeriesCache,
 	seriesList []*TcmSeries,
 	st int64,
 	et int64,
 ) ([]*TcmSamples, error) {
 	var samplesList []*TcmSamples
 
-	ctx, cancel := context.WithCancel(repo.ctx)
-	defer cancel()
-
-	err := repo.limiter.Wait(ctx)
+	err := repo.wait(ctx, m.Meta.Namespace)
 	if err != nil {
 		return nil, err
 	}
 
 	request := repo.buildGetMonitorDataRequest(m, seriesList, st, et)
+	if err := repo.budget.Reserve(m); err != nil {
+		return nil, err
+	}
+	request.SetContext(repo.budget.withRetryReserve(ctx, m))
 
 	start := time.Now()
 	response := &v20180724.GetMonitorDataResponse{}
-	response, err = repo.getMonitorDataWithRetry(m.Meta.ProductName, request)
+	response, err = repo.getMonitorData(m.Meta.ProductName, request)
 	if err != nil {
-		level.Error(repo.logger).Log(
-			"request metric name", *request.MetricName,
-			"request start time ", *request.StartTime,
-			"duration ", time.Since(start).Seconds(),
-			"err ", err.Error())
+		if ctx.Err() == nil {
+			level.Error(repo.logger).Log(
+				"request metric name", *request.MetricName,
+				"request start time ", *request.StartTime,
+				"duration ", time.Since(start).Seconds(),
+				"err ", err.Error())
+		}
 		return nil, err
 	}
 
 	for _, points := range response.Response.DataPoints {
-		samples, ql, e := repo.buildSamples(m, points)
+		samples, ql, e := repo.buildSamples(m, cache, points)
 		if e != nil {
 			level.Debug(repo.logger).Log(
 				"msg", e.Error(),
@@ -269,13 +378,14 @@ func (repo *TcmMetricRepositoryImpl) buildGetMonitorDataRequest(
 
 func (repo *TcmMetricRepositoryImpl) buildSamples(
 	m *TcmMetric,
+	cache *SeriesCache,
 	points *monitor.DataPoint,
 ) (*TcmSamples, map[string]string, error) {
 	ql := map[string]string{}
 	for _, dimension := range points.Dimensions {
 		name := *dimension.Name
 		if *dimension.Value != "" {
-			_, ok := m.SeriesCache.LabelNames[name]
+			_, ok := cache.LabelNames[name]
 			if !ok {
 				// if not in query label names, need ignore it
 				// because series id = query labels md5
@@ -288,7 +398,7 @@ func (repo *TcmMetricRepositoryImpl) buildSamples(
 	if e != nil {
 		return nil, ql, fmt.Errorf("get series id fail")
 	}
-	s, ok := m.SeriesCache.Series[sid]
+	s, ok := cache.Series[sid]
 	if !ok {
 		return nil, ql, fmt.Errorf("response data point not match series")
 	}
@@ -299,7 +409,12 @@ func (repo *TcmMetricRepositoryImpl) buildSamples(
 	return samples, ql, nil
 }
 
-func NewTcmMetricRepository(cred common.CredentialIface, conf *config.TencentConfig, logger log.Logger) (repo TcmMetricRepository, err error) {
+func NewTcmMetricRepository(
+	cred common.CredentialIface,
+	conf *config.TencentConfig,
+	budget *TcmBudget,
+	logger log.Logger,
+) (repo TcmMetricRepository, err error) {
 	monitorClient, err := client.NewMonitorClient(cred, conf, conf.Credential.Region)
 	if err != nil {
 		return
@@ -315,15 +430,23 @@ func NewTcmMetricRepository(cred common.CredentialIface, conf *config.TencentCon
 		}
 	}
 
+	limiters := map[string]*client.Limiter{}
+	for _, pconf := range conf.Products {
+		if pconf.RateLimit > 0 {
+			limiters[strings.ToLower(pconf.Namespace)] = client.NewLimiter(pconf.Namespace, pconf.RateLimit)
+		}
+	}
+
 	repo = &TcmMetricRepositoryImpl{
 		credential:               cred,
 		monitorClient:            monitorClient,
 		monitorClientInGuangzhou: monitorClientInGuangzhou,
 		monitorClientInSinapore:  monitorClientInSingapore,
-		limiter:                  rate.NewLimiter(rate.Limit(conf.RateLimit), 1),
-		ctx:                      context.Background(),
+		limiters:                 limiters,
+		budget:                   budget,
 		IsInternational:          conf.IsInternational,
 		queryMetricBatchSize:     conf.MetricQueryBatchSize,
+		queryMetricMaxDataPoints: conf.MetricQueryMaxDataPoints,
 		logger:                   logger,
 	}
 
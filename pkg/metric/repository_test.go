@@ -0,0 +1,388 @@
+package metric
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	sdkerrors "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+
+	"tencentcloud-exporter/pkg/common"
+	"tencentcloud-exporter/pkg/config"
+	"tencentcloud-exporter/pkg/fakecloud"
+)
+
+func newFakeCloudConfig(t *testing.T, s *fakecloud.Server) *config.TencentConfig {
+	content := fmt.Sprintf(`credential:
+  access_key: %s
+  secret_key: %s
+  region: ap-guangzhou
+client:
+  endpoint: %s
+metric_query_batch_size: 2
+products:
+  - namespace: QCE/CVM
+    all_metrics: true
+    all_instances: true
+    statistics_types: [last, max]
+`, s.SecretId, s.SecretKey, s.URL())
+	filename := filepath.Join(t.TempDir(), "qcloud.yml")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := config.NewConfig()
+	if err := conf.LoadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	return conf
+}
+
+func Test_RepositoryWithFakeCloud(t *testing.T) {
+	s := fakecloud.NewServer("AKID", "secret")
+	defer s.Close()
+	s.AddMetric(fakecloud.NewMetricSet("QCE/CVM", "CpuUsage", "%", "max", []int64{60, 300}, []string{"InstanceId"}))
+	s.SetMetricValues("QCE/CVM", "CpuUsage", func(dimensions map[string]string, ts int64) (float64, bool) {
+		if dimensions["InstanceId"] == "ins-nodata" {
+			return 0, false
+		}
+		return float64(len(dimensions["InstanceId"])), true
+	})
+	// 限频错误由client重试
+	s.InjectFault("monitor", "GetMonitorData", fakecloud.Fault{Error: fakecloud.NewError("RequestLimitExceeded", "too fast"), Times: 1})
+
+	conf := newFakeCloudConfig(t, s)
+	cred := &common.Credential{SecretId: conf.Credential.AccessKey, SecretKey: conf.Credential.SecretKey}
+	repo, err := NewTcmMetricRepository(cred, conf, NewTcmBudget(conf, log.NewNopLogger()), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := repo.GetMeta("QCE/CVM", "CpuUsage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pconf, err := conf.GetProductConfig("QCE/CVM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mconf, err := NewTcmMetricConfigWithProductYaml(pconf, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewTcmMetric(meta, mconf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var series []*TcmSeries
+	for _, id := range []string{"ins-1", "ins-22", "ins-333", "ins-nodata"} {
+		s, err := NewTcmSeries(m, Labels{"InstanceId": id}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		series = append(series, s)
+	}
+	if err := m.LoadSeries(series); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Unix()
+	samplesList, err := repo.ListSamples(context.Background(), m, now-300, now)
+	assert.NoError(t, err)
+	// 4个实例分2批查询, 没有数据点的实例不返回
+	assert.Len(t, samplesList, 3)
+	assert.Len(t, s.Requests("monitor", "GetMonitorData"), 3)
+	for _, samples := range samplesList {
+		assert.Equal(t, float64(len(samples.Series.QueryLabels["InstanceId"])), samples.Samples[0].Value)
+	}
+
+	pms, stats, err := m.QueryPromMetrics(context.Background(), repo)
+	assert.NoError(t, err)
+	assert.Len(t, pms, 3)
+	assert.Equal(t, 4, stats.Series)
+	assert.Equal(t, 1, stats.EmptySeries)
+	assert.NotZero(t, stats.SamplesReturned)
+	assert.Empty(t, m.GetNodataSeries())
+
+	// 连续2次没有数据点后跳过该时间线, 重新加载实例后恢复查询
+	m.Conf.NodataThreshold = 2
+	m.Conf.SkipNodataSeries = true
+	_, _, err = m.QueryPromMetrics(context.Background(), repo)
+	assert.NoError(t, err)
+	nodata := m.GetNodataSeries()
+	if assert.Len(t, nodata, 1) {
+		assert.Equal(t, "ins-nodata", nodata[0].QueryLabels["InstanceId"])
+	}
+	_, stats, err = m.QueryPromMetrics(context.Background(), repo)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, stats.Series)
+	assert.Equal(t, 0, stats.EmptySeries)
+
+	if err := m.LoadSeries(series); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, m.GetNodataSeries())
+	assert.Len(t, m.GetSeriesSplitByBatch(10)[0], 4)
+}
+
+func Test_OnMissingData(t *testing.T) {
+	s := fakecloud.NewServer("AKID", "secret")
+	defer s.Close()
+	s.AddMetric(fakecloud.NewMetricSet("QCE/CVM", "CpuUsage", "%", "max", []int64{60, 300}, []string{"InstanceId"}))
+	var stopped bool
+	s.SetMetricValues("QCE/CVM", "CpuUsage", func(dimensions map[string]string, ts int64) (float64, bool) {
+		if stopped && dimensions["InstanceId"] == "ins-22" {
+			return 0, false
+		}
+		return float64(len(dimensions["InstanceId"])), true
+	})
+
+	conf := newFakeCloudConfig(t, s)
+	cred := &common.Credential{SecretId: conf.Credential.AccessKey, SecretKey: conf.Credential.SecretKey}
+	repo, err := NewTcmMetricRepository(cred, conf, NewTcmBudget(conf, log.NewNopLogger()), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := repo.GetMeta("QCE/CVM", "CpuUsage")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, policy := range []string{"drop", "nan", "last_known(1h)", "last_known(1ns)"} {
+		t.Run(policy, func(t *testing.T) {
+			stopped = false
+			pconf, err := conf.GetProductConfig("QCE/CVM")
+			if err != nil {
+				t.Fatal(err)
+			}
+			pconf.OnMissingData = policy
+			mconf, err := NewTcmMetricConfigWithProductYaml(pconf, meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := NewTcmMetric(meta, mconf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var series []*TcmSeries
+			for _, id := range []string{"ins-1", "ins-22"} {
+				s, err := NewTcmSeries(m, Labels{"InstanceId": id}, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				series = append(series, s)
+			}
+			if err := m.LoadSeries(series); err != nil {
+				t.Fatal(err)
+			}
+			values := func() map[string]float64 {
+				pms, err := m.GetLatestPromMetrics(context.Background(), repo)
+				if err != nil {
+					t.Fatal(err)
+				}
+				values := map[string]float64{}
+				for _, pm := range pms {
+					var d dto.Metric
+					if err := pm.Write(&d); err != nil {
+						t.Fatal(err)
+					}
+					for _, l := range d.Label {
+						if l.GetName() == "instance_id" {
+							values[pm.Desc().String()+l.GetValue()] = d.GetGauge().GetValue()
+						}
+					}
+				}
+				return values
+			}
+			before := values()
+			assert.Len(t, before, 2)
+
+			stopped = true
+			got := values()
+			switch policy {
+			case "drop", "last_known(1ns)":
+				assert.Len(t, got, 1)
+			case "nan":
+				assert.Len(t, got, 2)
+				for k, v := range got {
+					assert.Equal(t, strings.HasSuffix(k, "ins-22"), math.IsNaN(v), k)
+				}
+			case "last_known(1h)":
+				assert.Equal(t, before, got)
+			}
+
+			// 实例不在缓存中后不再补充
+			if err := m.LoadSeries(series[:1]); err != nil {
+				t.Fatal(err)
+			}
+			assert.Len(t, values(), 1)
+		})
+	}
+	_, _, err = (&config.TencentProduct{OnMissingData: "last_known"}).GetOnMissingData()
+	assert.Error(t, err)
+}
+
+func Test_OnMissingDataNeverSeen(t *testing.T) {
+	s := fakecloud.NewServer("AKID", "secret")
+	defer s.Close()
+	s.AddMetric(fakecloud.NewMetricSet("QCE/CVM", "CpuUsage", "%", "max", []int64{60, 300}, []string{"InstanceId"}))
+	// 启动前已关机的实例一直没有数据
+	s.SetMetricValues("QCE/CVM", "CpuUsage", func(dimensions map[string]string, ts int64) (float64, bool) {
+		return 1, dimensions["InstanceId"] != "ins-stopped"
+	})
+
+	conf := newFakeCloudConfig(t, s)
+	cred := &common.Credential{SecretId: conf.Credential.AccessKey, SecretKey: conf.Credential.SecretKey}
+	repo, err := NewTcmMetricRepository(cred, conf, NewTcmBudget(conf, log.NewNopLogger()), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := repo.GetMeta("QCE/CVM", "CpuUsage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pconf, err := conf.GetProductConfig("QCE/CVM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pconf.OnMissingData = config.OnMissingDataNaN
+	mconf, err := NewTcmMetricConfigWithProductYaml(pconf, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewTcmMetric(meta, mconf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var series []*TcmSeries
+	for _, id := range []string{"ins-1", "ins-stopped"} {
+		s, err := NewTcmSeries(m, Labels{"InstanceId": id}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		series = append(series, s)
+	}
+	if err := m.LoadSeries(series); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, m.lastValues)
+
+	pms, err := m.GetLatestPromMetrics(context.Background(), repo)
+	assert.NoError(t, err)
+	// last使用统计周期的统计方式max, 与max只导出一个
+	got := map[string]float64{}
+	for _, pm := range pms {
+		var d dto.Metric
+		if err := pm.Write(&d); err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range d.Label {
+			if l.GetName() == "instance_id" {
+				got[pm.Desc().String()+l.GetValue()] = d.GetGauge().GetValue()
+			}
+		}
+	}
+	assert.Len(t, got, 2)
+	for k, v := range got {
+		assert.Equal(t, strings.HasSuffix(k, "ins-stopped"), math.IsNaN(v), k)
+	}
+}
+
+func Test_ListSamplesPartialError(t *testing.T) {
+	s := fakecloud.NewServer("AKID", "secret")
+	defer s.Close()
+	s.AddMetric(fakecloud.NewMetricSet("QCE/CVM", "CpuUsage", "%", "max", []int64{60, 300}, []string{"InstanceId"}))
+	s.SetMetricValues("QCE/CVM", "CpuUsage", func(dimensions map[string]string, ts int64) (float64, bool) {
+		return 1, true
+	})
+	// 参数错误不重试, 4个实例分2批查询, 只有一批失败
+	s.InjectFault("monitor", "GetMonitorData", fakecloud.Fault{Error: fakecloud.NewError("InvalidParameter", "bad dimension"), Times: 1})
+
+	conf := newFakeCloudConfig(t, s)
+	cred := &common.Credential{SecretId: conf.Credential.AccessKey, SecretKey: conf.Credential.SecretKey}
+	repo, err := NewTcmMetricRepository(cred, conf, NewTcmBudget(conf, log.NewNopLogger()), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := repo.GetMeta("QCE/CVM", "CpuUsage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pconf, err := conf.GetProductConfig("QCE/CVM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mconf, err := NewTcmMetricConfigWithProductYaml(pconf, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewTcmMetric(meta, mconf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var series []*TcmSeries
+	for _, id := range []string{"ins-1", "ins-2", "ins-3", "ins-4"} {
+		s, err := NewTcmSeries(m, Labels{"InstanceId": id}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		series = append(series, s)
+	}
+	if err := m.LoadSeries(series); err != nil {
+		t.Fatal(err)
+	}
+
+	pms, stats, err := m.QueryPromMetrics(context.Background(), repo)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "InvalidParameter")
+	}
+	assert.Len(t, pms, 2)
+	assert.Equal(t, 2, stats.EmptySeries)
+	// 失败的批次不计入没有数据的时间线
+	m.Conf.NodataThreshold = 1
+	assert.Empty(t, m.GetNodataSeries())
+
+	pms, _, err = m.QueryPromMetrics(context.Background(), repo)
+	assert.NoError(t, err)
+	assert.Len(t, pms, 4)
+
+	// 配额等其他LimitExceeded错误不拆分批次, 不增加调用次数
+	before := len(s.Requests("monitor", "GetMonitorData"))
+	s.InjectFault("monitor", "GetMonitorData", fakecloud.Fault{Error: fakecloud.NewError("LimitExceeded.RequestQuota", "quota exceeded"), Times: 2})
+	_, _, err = m.QueryPromMetrics(context.Background(), repo)
+	assert.Error(t, err)
+	assert.Len(t, s.Requests("monitor", "GetMonitorData"), before+2)
+}
+
+func Test_isTooManyDataPointsError(t *testing.T) {
+	cases := []struct {
+		code    string
+		message string
+		want    bool
+	}{
+		{"LimitExceeded.MetricQueryPointNumber", "query points exceed 1440", true},
+		{"LimitExceeded", "too many data points in one request", true},
+		{"LimitExceeded", "", false},
+		{"LimitExceeded.MetricQuota", "metric quota exceeded", false},
+		{"LimitExceeded.RequestQuota", "daily request quota exceeded", false},
+		{"InvalidParameter", "too many data points in one request", true},
+		{"InvalidParameterValue", "查询的数据点超过上限", true},
+		{"RequestLimitExceeded", "Your current request times equals to `21` in a second, which exceeds the frequency limit `20` for a second.", false},
+		{"RequestLimitExceeded.UinLimitExceeded", "request limit exceeded", false},
+		{"InternalError", "data points exceed", false},
+		{"InvalidParameter", "instance count exceeds", false},
+		{"AuthFailure.SignatureFailure", "too many", false},
+	}
+	for _, c := range cases {
+		err := sdkerrors.NewTencentCloudSDKError(c.code, c.message, "req-id")
+		assert.Equal(t, c.want, isTooManyDataPointsError(err), "%s: %s", c.code, c.message)
+	}
+	assert.False(t, isTooManyDataPointsError(fmt.Errorf("too many data points")))
+}
@@ -0,0 +1,50 @@
+package metric
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	monitor "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/monitor/v20180724"
+
+	"tencentcloud-exporter/pkg/util"
+)
+
+// 指标元数据快照文件内容, 保存DescribeBaseMetrics的原始返回
+type metaSnapshot struct {
+	Namespace  string
+	Timestamp  int64
+	MetricSets []*monitor.MetricSet
+}
+
+func metaSnapshotFile(stateDir string, namespace string) string {
+	return filepath.Join(stateDir, fmt.Sprintf("meta_%s.json", util.NamespaceFileName(namespace)))
+}
+
+func saveMetaSnapshot(stateDir string, namespace string, metas []*TcmMeta, ts time.Time) error {
+	snapshot := &metaSnapshot{
+		Namespace: namespace,
+		Timestamp: ts.Unix(),
+	}
+	for _, meta := range metas {
+		snapshot.MetricSets = append(snapshot.MetricSets, meta.m)
+	}
+	return util.WriteJSONFileAtomic(metaSnapshotFile(stateDir, namespace), snapshot)
+}
+
+func loadMetaSnapshot(stateDir string, namespace string) ([]*TcmMeta, time.Time, error) {
+	snapshot := &metaSnapshot{}
+	err := util.ReadJSONFile(metaSnapshotFile(stateDir, namespace), snapshot)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var metas []*TcmMeta
+	for _, metricSet := range snapshot.MetricSets {
+		meta, err := NewTcmMeta(metricSet)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		metas = append(metas, meta)
+	}
+	return metas, time.Unix(snapshot.Timestamp, 0), nil
+}
@@ -0,0 +1,78 @@
+package metric
+
+import (
+	"strings"
+)
+
+// 云监控指标单位到Prometheus基本单位的转换, 导出值=原始值×Scale, 指标名加Suffix后缀
+type TcmUnit struct {
+	Suffix string
+	Scale  float64
+}
+
+var (
+	unitNone = TcmUnit{Scale: 1}
+
+	// key为小写的云监控单位
+	unitMap = map[string]TcmUnit{
+		"%":       {Suffix: "ratio", Scale: 0.01},
+		"b":       {Suffix: "bytes", Scale: 1},
+		"byte":    {Suffix: "bytes", Scale: 1},
+		"bytes":   {Suffix: "bytes", Scale: 1},
+		"kb":      {Suffix: "bytes", Scale: 1 << 10},
+		"mb":      {Suffix: "bytes", Scale: 1 << 20},
+		"gb":      {Suffix: "bytes", Scale: 1 << 30},
+		"tb":      {Suffix: "bytes", Scale: 1 << 40},
+		"b/s":     {Suffix: "bytes_per_second", Scale: 1},
+		"bytes/s": {Suffix: "bytes_per_second", Scale: 1},
+		"kb/s":    {Suffix: "bytes_per_second", Scale: 1 << 10},
+		"mb/s":    {Suffix: "bytes_per_second", Scale: 1 << 20},
+		"gb/s":    {Suffix: "bytes_per_second", Scale: 1 << 30},
+		"bps":     {Suffix: "bits_per_second", Scale: 1},
+		"kbps":    {Suffix: "bits_per_second", Scale: 1e3},
+		"mbps":    {Suffix: "bits_per_second", Scale: 1e6},
+		"gbps":    {Suffix: "bits_per_second", Scale: 1e9},
+		"us":      {Suffix: "seconds", Scale: 1e-6},
+		"ms":      {Suffix: "seconds", Scale: 1e-3},
+		"s":       {Suffix: "seconds", Scale: 1},
+		"min":     {Suffix: "seconds", Scale: 60},
+		"count/s": {Suffix: "per_second", Scale: 1},
+		"次/秒":     {Suffix: "per_second", Scale: 1},
+		"个/秒":     {Suffix: "per_second", Scale: 1},
+		"pps":     {Suffix: "per_second", Scale: 1},
+		"qps":     {Suffix: "per_second", Scale: 1},
+	}
+)
+
+// 未知单位不做转换
+func GetTcmUnit(unit string) TcmUnit {
+	if u, ok := unitMap[strings.ToLower(strings.TrimSpace(unit))]; ok {
+		return u
+	}
+	return unitNone
+}
+
+// 按统计方法调整单位: count是数据点个数, 没有单位; rate是每秒增长率
+func (u TcmUnit) ForStatType(st string) TcmUnit {
+	switch st {
+	case "count":
+		return unitNone
+	case "rate":
+		if strings.HasSuffix(u.Suffix, "per_second") {
+			return u
+		}
+		if u.Suffix == "" {
+			return TcmUnit{Suffix: "per_second", Scale: u.Scale}
+		}
+		return TcmUnit{Suffix: u.Suffix + "_per_second", Scale: u.Scale}
+	}
+	return u
+}
+
+// 指标名已经以单位结尾时不重复添加
+func (u TcmUnit) AppendSuffix(name string) string {
+	if u.Suffix == "" || strings.HasSuffix(name, "_"+u.Suffix) {
+		return name
+	}
+	return name + "_" + u.Suffix
+}
@@ -0,0 +1,71 @@
+package metric
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GetTcmUnit(t *testing.T) {
+	cases := []struct {
+		unit string
+		want TcmUnit
+	}{
+		{"%", TcmUnit{Suffix: "ratio", Scale: 0.01}},
+		{"MB", TcmUnit{Suffix: "bytes", Scale: 1 << 20}},
+		{" KB/s ", TcmUnit{Suffix: "bytes_per_second", Scale: 1 << 10}},
+		{"Mbps", TcmUnit{Suffix: "bits_per_second", Scale: 1e6}},
+		{"ms", TcmUnit{Suffix: "seconds", Scale: 1e-3}},
+		{"次/秒", TcmUnit{Suffix: "per_second", Scale: 1}},
+		// 未知单位不做转换
+		{"", unitNone},
+		{"个", unitNone},
+		{"dBm", unitNone},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, GetTcmUnit(c.unit), c.unit)
+	}
+}
+
+func Test_TcmUnitForStatType(t *testing.T) {
+	cases := []struct {
+		unit string
+		st   string
+		want TcmUnit
+	}{
+		{"MB", "max", TcmUnit{Suffix: "bytes", Scale: 1 << 20}},
+		{"MB", "p99", TcmUnit{Suffix: "bytes", Scale: 1 << 20}},
+		{"MB", "count", unitNone},
+		{"MB", "rate", TcmUnit{Suffix: "bytes_per_second", Scale: 1 << 20}},
+		// 已经是每秒的单位不重复添加
+		{"MB/s", "rate", TcmUnit{Suffix: "bytes_per_second", Scale: 1 << 20}},
+		{"count/s", "rate", TcmUnit{Suffix: "per_second", Scale: 1}},
+		// 未知单位
+		{"个", "rate", TcmUnit{Suffix: "per_second", Scale: 1}},
+		{"个", "count", unitNone},
+		{"个", "avg", unitNone},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, GetTcmUnit(c.unit).ForStatType(c.st), "%s %s", c.unit, c.st)
+	}
+}
+
+func Test_TcmUnitAppendSuffix(t *testing.T) {
+	cases := []struct {
+		unit string
+		name string
+		want string
+	}{
+		{"%", "qce_cvm_cpu_usage_max", "qce_cvm_cpu_usage_max_ratio"},
+		{"MB", "qce_cvm_mem_used_max", "qce_cvm_mem_used_max_bytes"},
+		// 已经以单位结尾
+		{"B", "qce_cos_std_storage_bytes", "qce_cos_std_storage_bytes"},
+		// 只匹配完整的后缀
+		{"B", "qce_cos_outbytes", "qce_cos_outbytes_bytes"},
+		// 未知单位不加后缀
+		{"个", "qce_cvm_tcp_connections_max", "qce_cvm_tcp_connections_max"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, GetTcmUnit(c.unit).AppendSuffix(c.name), c.name)
+	}
+}
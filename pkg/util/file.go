@@ -0,0 +1,47 @@
+package util
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WriteJSONFileAtomic 先写临时文件再rename, 避免进程退出时留下写了一半的文件
+func WriteJSONFileAtomic(filename string, v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(filename)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// ReadJSONFile 文件不存在时返回os.ErrNotExist
+func ReadJSONFile(filename string, v interface{}) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+// NamespaceFileName 将QCE/CVM转换为qce_cvm, 用于文件名
+func NamespaceFileName(namespace string) string {
+	return strings.ToLower(strings.ReplaceAll(namespace, "/", "_"))
+}